@@ -0,0 +1,312 @@
+package healthchecker
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ArgType int
+
+const (
+	ArgString    ArgType = 0
+	ArgInt       ArgType = 1
+	ArgBool      ArgType = 2
+	ArgPort      ArgType = 3
+	ArgRegexp    ArgType = 4
+	ArgURL       ArgType = 5
+	ArgFloatList ArgType = 6
+	ArgFloat     ArgType = 7
+	ArgCheckExpr ArgType = 8
+)
+
+func (t ArgType) String() string {
+	switch t {
+	case ArgInt:
+		return "int"
+	case ArgBool:
+		return "bool"
+	case ArgPort:
+		return "port"
+	case ArgRegexp:
+		return "regexp"
+	case ArgURL:
+		return "url"
+	case ArgFloatList:
+		return "float list"
+	case ArgFloat:
+		return "float"
+	case ArgCheckExpr:
+		return "check expression"
+	default:
+		return "string"
+	}
+}
+
+// ArgSpec describes one argument accepted by a check or sink constructor. A
+// Name ending in '*' matches every argument starting with the rest of it.
+type ArgSpec struct {
+	Name        string
+	Type        ArgType
+	Required    bool
+	Default     string
+	Description string
+}
+
+// ArgSchema lists the arguments a constructor accepts. ForwardTo names the
+// argument holding the type of a wrapped sink, whose schema is then used for
+// all arguments not listed in Args.
+type ArgSchema struct {
+	Args      []ArgSpec
+	ForwardTo string
+}
+
+func (s ArgSchema) spec(name string) (ArgSpec, bool) {
+	for _, spec := range s.Args {
+		if spec.Name == name {
+			return spec, true
+		}
+		if strings.HasSuffix(spec.Name, "*") && strings.HasPrefix(name, strings.TrimSuffix(spec.Name, "*")) {
+			return spec, true
+		}
+	}
+	return ArgSpec{}, false
+}
+
+func checkArgType(spec ArgSpec, value string) error {
+	switch spec.Type {
+	case ArgInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("'%s' must be an integer, got: %s", spec.Name, value)
+		}
+	case ArgBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("'%s' must be true or false, got: %s", spec.Name, value)
+		}
+	case ArgPort:
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("'%s' must be between 1 and 65535, got: %s", spec.Name, value)
+		}
+	case ArgRegexp:
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("'%s' is not a valid regexp: %s", spec.Name, err)
+		}
+	case ArgURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("'%s' must be an absolute URL, got: %s", spec.Name, value)
+		}
+	case ArgFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("'%s' must be a number, got: %s", spec.Name, value)
+		}
+	case ArgCheckExpr:
+		if _, err := parseCompositeExpr(value); err != nil {
+			return fmt.Errorf("'%s' is not a valid check expression: %s", spec.Name, err)
+		}
+	case ArgFloatList:
+		for _, item := range strings.Split(value, ",") {
+			if _, err := strconv.ParseFloat(strings.TrimSpace(item), 64); err != nil {
+				return fmt.Errorf("'%s' must be a comma separated list of numbers, got: %s", spec.Name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate returns every problem with args, ordered by argument name.
+// Arguments forwarded to a wrapped sink are returned in forwarded.
+func (s ArgSchema) Validate(args map[string]string) (problems []string, forwarded map[string]string) {
+	for _, spec := range s.Args {
+		if _, ok := args[spec.Name]; spec.Required && !ok {
+			problems = append(problems, fmt.Sprintf("missing required arg '%s'", spec.Name))
+		}
+	}
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec, ok := s.spec(name)
+		if !ok {
+			if s.ForwardTo != "" {
+				if forwarded == nil {
+					forwarded = make(map[string]string)
+				}
+				forwarded[name] = args[name]
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("unknown arg '%s'", name))
+			continue
+		}
+		if err := checkArgType(spec, args[name]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems, forwarded
+}
+
+// Lookup returns the arg name, or the default of its spec when it isn't set.
+// ok is false when the arg has neither.
+func (s ArgSchema) Lookup(args map[string]string, name string) (value string, ok bool) {
+	if value, ok = args[name]; ok {
+		return value, true
+	}
+	spec, _ := s.spec(name)
+	return spec.Default, spec.Default != ""
+}
+
+// Int returns the arg name, or its default, as an integer checked against the
+// type of its spec.
+func (s ArgSchema) Int(args map[string]string, name string) (int, error) {
+	value, ok := s.Lookup(args, name)
+	if !ok {
+		return 0, fmt.Errorf("'%s' parameter missing", name)
+	}
+	spec, _ := s.spec(name)
+	spec.Name = name
+	if spec.Type != ArgPort {
+		spec.Type = ArgInt
+	}
+	if err := checkArgType(spec, value); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// ConfigError lists every problem found in a config.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("Invalid config:\n  %s", strings.Join(e.Problems, "\n  "))
+}
+
+func checkLocation(conf HealthChecksConfig) string {
+	if conf.Line > 0 {
+		return fmt.Sprintf("line %d: check '%s'", conf.Line, conf.Name)
+	}
+	return fmt.Sprintf("check '%s'", conf.Name)
+}
+
+// sinkIdArg is accepted by every sink to share it between checks.
+var sinkIdArg = ArgSpec{Name: "id", Description: "share this sink between all checks using the same id"}
+
+func (c *Registry) validateSink(sinkType string, args map[string]string) []string {
+	if _, ok := c.SinkConstructors[sinkType]; !ok {
+		return []string{fmt.Sprintf("unknown sink type '%s'", sinkType)}
+	}
+	schema, ok := c.SinkSchemas[sinkType]
+	if !ok {
+		return nil
+	}
+	schema.Args = append([]ArgSpec{sinkIdArg}, schema.Args...)
+	problems, forwarded := schema.Validate(args)
+	for i, problem := range problems {
+		problems[i] = fmt.Sprintf("sink '%s': %s", sinkType, problem)
+	}
+	if schema.ForwardTo != "" {
+		if target, ok := args[schema.ForwardTo]; ok {
+			problems = append(problems, c.validateSink(target, forwarded)...)
+		}
+	}
+	return problems
+}
+
+func (c *Registry) validateCheck(conf HealthChecksConfig) []string {
+	problems := make([]string, 0)
+	if conf.Name == "" {
+		problems = append(problems, "missing 'name'")
+	}
+	if _, ok := c.CheckConstructors[conf.Type]; !ok {
+		problems = append(problems, fmt.Sprintf("unknown check type '%s'", conf.Type))
+	} else if schema, ok := c.CheckSchemas[conf.Type]; ok {
+		argProblems, _ := schema.Validate(conf.Args)
+		problems = append(problems, argProblems...)
+	}
+	if conf.Schedule == "" && conf.Interval < 1 {
+		problems = append(problems, fmt.Sprintf("'interval' must be at least 1 second, got: %d", conf.Interval))
+	}
+	if conf.Schedule != "" && conf.Interval != 0 {
+		problems = append(problems, "'interval' and 'schedule' cannot both be set")
+	}
+	if _, err := ScheduleFromConfig(conf); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if conf.Timeout < 0 {
+		problems = append(problems, fmt.Sprintf("'timeout' cannot be negative, got: %d", conf.Timeout))
+	}
+	if conf.FailuresBeforeDown < 0 || conf.SuccessesBeforeUp < 0 {
+		problems = append(problems, "'failuresBeforeDown' and 'successesBeforeUp' cannot be negative")
+	}
+	if conf.Retries < 0 || conf.RetryDelay < 0 {
+		problems = append(problems, "'retries' and 'retryDelay' cannot be negative")
+	}
+	if _, err := ParseUpstreamMode(conf.OnUpstreamDown); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := ParseSplayMode(conf.Splay); err != nil {
+		problems = append(problems, fmt.Sprintf("'splay' must be one of none, random or hash, got: %s", conf.Splay))
+	}
+	if conf.Jitter < 0 || (conf.Interval > 0 && conf.Jitter >= conf.Interval*1000) {
+		problems = append(problems, fmt.Sprintf("'jitter' must be between 0 and the interval in milliseconds, got: %d", conf.Jitter))
+	}
+	for _, sinkConfig := range conf.Sinks {
+		for sinkType, sinkArgs := range sinkConfig {
+			problems = append(problems, c.validateSink(sinkType, sinkArgs)...)
+		}
+	}
+	return problems
+}
+
+// configProblems returns the problems of every check in conf, indexed like
+// conf.HealthChecks.
+func (c *Registry) configProblems(conf *Config) [][]string {
+	seen := make(map[string]int)
+	problems := make([][]string, len(conf.HealthChecks))
+	dependencies := dependencyProblems(conf.HealthChecks)
+	names := make(map[string]bool, len(conf.HealthChecks))
+	for _, hc := range conf.HealthChecks {
+		names[hc.Name] = true
+	}
+	for i, hc := range conf.HealthChecks {
+		problems[i] = c.validateCheck(hc)
+		if first, ok := seen[hc.Name]; ok && hc.Name != "" {
+			problems[i] = append(problems[i], fmt.Sprintf("duplicate name, already used by check #%d", first+1))
+		} else {
+			seen[hc.Name] = i
+		}
+		problems[i] = append(problems[i], dependencies[i]...)
+		for _, ref := range c.CheckSchemas[hc.Type].checkRefs(hc.Args) {
+			if !names[ref.check] {
+				problems[i] = append(problems[i], fmt.Sprintf("'%s' names unknown check '%s'", ref.arg, ref.check))
+			}
+		}
+		for j, problem := range problems[i] {
+			problems[i][j] = fmt.Sprintf("%s: %s", checkLocation(hc), problem)
+		}
+	}
+	return problems
+}
+
+// ValidateConfig checks conf against the registered check and sink types and
+// their argument schemas, returning a *ConfigError with every problem found.
+func (c *Registry) ValidateConfig(conf *Config) error {
+	all := make([]string, 0)
+	for _, problems := range c.configProblems(conf) {
+		all = append(all, problems...)
+	}
+	for _, maintenance := range conf.Maintenance {
+		if _, err := newMaintenanceWindow(maintenance); err != nil {
+			all = append(all, fmt.Sprintf("%s: %s", maintenanceLocation(maintenance), err))
+		}
+	}
+	if len(all) > 0 {
+		return &ConfigError{Problems: all}
+	}
+	return nil
+}
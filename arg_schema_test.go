@@ -0,0 +1,152 @@
+package healthchecker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArgSchemaValidate(t *testing.T) {
+	schema := ArgSchema{Args: []ArgSpec{
+		{Name: "host", Required: true},
+		{Name: "port", Type: ArgPort},
+		{Name: "count", Type: ArgInt},
+		{Name: "verbose", Type: ArgBool},
+		{Name: "expect", Type: ArgRegexp},
+		{Name: "url", Type: ArgURL},
+		{Name: "buckets", Type: ArgFloatList},
+		{Name: "header.*"},
+	}}
+	argTests := []struct {
+		name     string
+		args     map[string]string
+		problems int
+	}{
+		{"valid", map[string]string{"host": "example.com", "port": "80", "count": "3", "verbose": "true",
+			"expect": "^OK", "url": "http://example.com/x", "buckets": "0.1, 1", "header.X-Token": "t"}, 0},
+		{"missing required", map[string]string{"port": "80"}, 1},
+		{"unknown arg", map[string]string{"host": "example.com", "hots": "x"}, 1},
+		{"bad port", map[string]string{"host": "example.com", "port": "99999"}, 1},
+		{"bad int", map[string]string{"host": "example.com", "count": "three"}, 1},
+		{"bad bool", map[string]string{"host": "example.com", "verbose": "sure"}, 1},
+		{"bad regexp", map[string]string{"host": "example.com", "expect": "(OK"}, 1},
+		{"relative url", map[string]string{"host": "example.com", "url": "/x"}, 1},
+		{"bad buckets", map[string]string{"host": "example.com", "buckets": "0.1,x"}, 1},
+		{"everything wrong", map[string]string{"port": "0", "count": "x", "other": "y"}, 4},
+	}
+
+	for _, tt := range argTests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, _ := schema.Validate(tt.args)
+			if len(problems) != tt.problems {
+				t.Errorf("Expected %d problems, got: %v", tt.problems, problems)
+			}
+		})
+	}
+}
+
+func TestArgSchemaValidateForwarded(t *testing.T) {
+	schema := ArgSchema{Args: []ArgSpec{{Name: "sink", Required: true}}, ForwardTo: "sink"}
+	problems, forwarded := schema.Validate(map[string]string{"sink": "FileSink", "path": "/tmp/x"})
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems, got: %v", problems)
+	}
+	if !reflect.DeepEqual(forwarded, map[string]string{"path": "/tmp/x"}) {
+		t.Errorf("Unexpected forwarded args: %v", forwarded)
+	}
+}
+
+func TestArgSchemaDefaults(t *testing.T) {
+	schema := ArgSchema{Args: []ArgSpec{
+		{Name: "host", Required: true},
+		{Name: "port", Type: ArgPort, Default: "443"},
+		{Name: "count", Type: ArgInt},
+	}}
+	if value, ok := schema.Lookup(map[string]string{}, "port"); !ok || value != "443" {
+		t.Errorf("Expected the default port, got %q", value)
+	}
+	if _, ok := schema.Lookup(map[string]string{}, "host"); ok {
+		t.Errorf("Expected an arg without a default to be missing")
+	}
+	if port, err := schema.Int(map[string]string{}, "port"); err != nil || port != 443 {
+		t.Errorf("Expected the default port, got %d: %v", port, err)
+	}
+	if port, err := schema.Int(map[string]string{"port": "8443"}, "port"); err != nil || port != 8443 {
+		t.Errorf("Expected port 8443, got %d: %v", port, err)
+	}
+	for _, args := range []map[string]string{{"port": "99999"}, {"count": "three"}, {}} {
+		name := "count"
+		if _, ok := args["port"]; ok {
+			name = "port"
+		}
+		if _, err := schema.Int(args, name); err == nil {
+			t.Errorf("Expected %s in %v to fail", name, args)
+		}
+	}
+}
+
+func newValidatingRegistry() *Registry {
+	registry := NewRegistry()
+	registry.RegisterCheckType("testing", testingCheckConstructor, ArgSchema{Args: []ArgSpec{
+		{Name: "url", Type: ArgURL, Required: true},
+	}})
+	registry.RegisterSinkType("recording", func(_ map[string]string) (Emitter, error) {
+		return &recordingSink{}, nil
+	}, ArgSchema{Args: []ArgSpec{{Name: "count", Type: ArgInt}}})
+	registry.RegisterSinkType("StateChangeSink", registry.NewStateChangeSink, StateChangeSinkArgs)
+	return registry
+}
+
+func TestValidateConfig(t *testing.T) {
+	config := &Config{HealthChecks: []HealthChecksConfig{
+		{Name: "good", Type: "testing", Args: map[string]string{"url": "http://example.com"}, Interval: 5, Line: 3},
+		{Name: "bad", Type: "testing", Args: map[string]string{"url": "example"}, Line: 7,
+			Sinks: []map[string]map[string]string{
+				{"recording": {"count": "x", "id": "shared"}},
+				{"StateChangeSink": {"sink": "recording", "colour": "red"}},
+				{"nope": {}},
+			}},
+		{Name: "good", Type: "unknown", Interval: 5, Line: 15},
+	}}
+	err := newValidatingRegistry().ValidateConfig(config)
+	configErr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("Expected a ConfigError, got: %v", err)
+	}
+	expected := []string{
+		"line 7: check 'bad': 'url' must be an absolute URL, got: example",
+		"line 7: check 'bad': 'interval' must be at least 1 second, got: 0",
+		"line 7: check 'bad': sink 'recording': 'count' must be an integer, got: x",
+		"line 7: check 'bad': sink 'recording': unknown arg 'colour'",
+		"line 7: check 'bad': unknown sink type 'nope'",
+		"line 15: check 'good': unknown check type 'unknown'",
+		"line 15: check 'good': duplicate name, already used by check #1",
+	}
+	if !reflect.DeepEqual(configErr.Problems, expected) {
+		t.Errorf("Got problems:\n%s\nwanted:\n%s", strings.Join(configErr.Problems, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestRegisterHealthChecksInvalid(t *testing.T) {
+	config := &Config{HealthChecks: []HealthChecksConfig{
+		{Name: "good", Type: "testing", Args: map[string]string{"url": "http://example.com"}, Interval: 5},
+		{Name: "bad", Type: "testing", Interval: 5},
+	}}
+
+	registry := newValidatingRegistry()
+	if err := registry.RegisterHealthChecks(config); err == nil {
+		t.Errorf("Expected invalid config to be rejected")
+	}
+	if len(registry.Checks) != 0 {
+		t.Errorf("Rejected config should not register any checks, got %d", len(registry.Checks))
+	}
+
+	registry = newValidatingRegistry()
+	registry.SkipInvalidChecks = true
+	if err := registry.RegisterHealthChecks(config); err != nil {
+		t.Errorf("Expected invalid checks to be skipped, got: %s", err)
+	}
+	if len(registry.Checks) != 1 || registry.Checks[0].Name != "good" {
+		t.Errorf("Expected only the valid check to be registered, got: %v", registry.Checks)
+	}
+}
@@ -0,0 +1,222 @@
+package healthchecker
+
+import (
+	"sync"
+	"time"
+)
+
+type Status int
+
+const (
+	StatusUnknown  Status = 0
+	StatusUp       Status = 1
+	StatusDown     Status = 2
+	StatusFlapping Status = 3
+)
+
+const (
+	defaultFailuresBeforeDown = 1
+	defaultSuccessesBeforeUp  = 1
+	// A check is flapping when its raw result changed at least flapStart
+	// times within the last flapWindow results, and stops flapping once that
+	// drops to flapStop or fewer.
+	flapWindow = 10
+	flapStart  = 6
+	flapStop   = 3
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusUp:
+		return "up"
+	case StatusDown:
+		return "down"
+	case StatusFlapping:
+		return "flapping"
+	default:
+		return "unknown"
+	}
+}
+
+// CheckState is the state of a check after its latest result.
+type CheckState struct {
+	Status               Status
+	Previous             Status
+	Changed              bool
+	Since                time.Time
+	LastUp               time.Time
+	LastDown             time.Time
+	ConsecutiveFailures  int
+	ConsecutiveSuccesses int
+}
+
+type stateTracker struct {
+	mu                 sync.Mutex
+	state              CheckState
+	failuresBeforeDown int
+	successesBeforeUp  int
+	history            []bool
+	last               *Result
+}
+
+func newStateTracker() *stateTracker {
+	return &stateTracker{
+		failuresBeforeDown: defaultFailuresBeforeDown,
+		successesBeforeUp:  defaultSuccessesBeforeUp,
+		history:            make([]bool, 0, flapWindow),
+	}
+}
+
+func (t *stateTracker) setThresholds(failuresBeforeDown, successesBeforeUp int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if failuresBeforeDown > 0 {
+		t.failuresBeforeDown = failuresBeforeDown
+	}
+	if successesBeforeUp > 0 {
+		t.successesBeforeUp = successesBeforeUp
+	}
+}
+
+func (t *stateTracker) flapCount() int {
+	changes := 0
+	for i := 1; i < len(t.history); i++ {
+		if t.history[i] != t.history[i-1] {
+			changes++
+		}
+	}
+	return changes
+}
+
+func (t *stateTracker) nextStatus() Status {
+	current := t.state.Status
+	flaps := t.flapCount()
+	if flaps >= flapStart || (current == StatusFlapping && flaps > flapStop) {
+		return StatusFlapping
+	}
+	if current != StatusDown && t.state.ConsecutiveFailures >= t.failuresBeforeDown {
+		return StatusDown
+	}
+	if current != StatusUp && t.state.ConsecutiveSuccesses >= t.successesBeforeUp {
+		return StatusUp
+	}
+	return current
+}
+
+// update feeds res into the state machine and returns the resulting state.
+// UpstreamDown results leave the state as it is.
+func (t *stateTracker) update(res *Result) CheckState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.last = res
+	if res.Result == UpstreamDown {
+		t.state.Changed = false
+		return t.state
+	}
+	ok := res.Result == Success
+	if ok {
+		t.state.ConsecutiveSuccesses++
+		t.state.ConsecutiveFailures = 0
+	} else {
+		t.state.ConsecutiveFailures++
+		t.state.ConsecutiveSuccesses = 0
+	}
+	if len(t.history) == flapWindow {
+		t.history = append(t.history[:0], t.history[1:]...)
+	}
+	t.history = append(t.history, ok)
+
+	next := t.nextStatus()
+	t.state.Changed = next != t.state.Status
+	if t.state.Changed {
+		t.state.Previous = t.state.Status
+		t.state.Status = next
+		t.state.Since = res.Timestamp
+		switch next {
+		case StatusUp:
+			t.state.LastUp = res.Timestamp
+		case StatusDown:
+			t.state.LastDown = res.Timestamp
+		}
+	}
+	return t.state
+}
+
+// restore rebuilds the state from entries recorded by a previous run, oldest
+// first. Since is only as old as the first entry when the latest status
+// started before it. UpstreamDown entries don't count as failures.
+func (t *stateTracker) restore(entries []HistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last := entries[len(entries)-1]
+	state := CheckState{Status: last.Status}
+	counted := make([]HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Result != UpstreamDown {
+			counted = append(counted, entry)
+		}
+	}
+	lastOk := len(counted) > 0 && counted[len(counted)-1].Result == Success
+	countingRun := true
+	for i := len(counted) - 1; i >= 0; i-- {
+		entry := counted[i]
+		if countingRun && (entry.Result == Success) == lastOk {
+			if lastOk {
+				state.ConsecutiveSuccesses++
+			} else {
+				state.ConsecutiveFailures++
+			}
+		} else {
+			countingRun = false
+		}
+	}
+	for i, entry := range entries {
+		if i > 0 && entry.Status == entries[i-1].Status {
+			continue
+		}
+		state.Since = entry.Timestamp
+		if i > 0 {
+			state.Previous = entries[i-1].Status
+		}
+		switch entry.Status {
+		case StatusUp:
+			state.LastUp = entry.Timestamp
+		case StatusDown:
+			state.LastDown = entry.Timestamp
+		}
+	}
+	t.state = state
+
+	window := counted
+	if len(window) > flapWindow {
+		window = window[len(window)-flapWindow:]
+	}
+	t.history = t.history[:0]
+	for _, entry := range window {
+		t.history = append(t.history, entry.Result == Success)
+	}
+	t.last = &Result{
+		Timestamp: last.Timestamp,
+		Result:    last.Result,
+		Duration:  last.Duration,
+		Message:   last.Message,
+		Category:  last.Category,
+	}
+}
+
+func (t *stateTracker) current() CheckState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+func (t *stateTracker) lastResult() *Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
@@ -0,0 +1,116 @@
+package healthchecker
+
+import (
+	"testing"
+	"time"
+)
+
+func feedResults(tracker *stateTracker, outcomes string) []CheckState {
+	states := make([]CheckState, 0, len(outcomes))
+	timestamp := time.Now()
+	for _, outcome := range outcomes {
+		res := &Result{Timestamp: timestamp, Result: Success}
+		if outcome == 'F' {
+			res.Result = Failure
+		}
+		states = append(states, tracker.update(res))
+		timestamp = timestamp.Add(time.Second)
+	}
+	return states
+}
+
+func TestStateTrackerThresholds(t *testing.T) {
+	stateTests := []struct {
+		name               string
+		failuresBeforeDown int
+		successesBeforeUp  int
+		outcomes           string
+		want               []Status
+	}{
+		{"defaults", 0, 0, "SFS",
+			[]Status{StatusUp, StatusDown, StatusUp}},
+		{"single failure tolerated", 3, 1, "SFSFFF",
+			[]Status{StatusUp, StatusUp, StatusUp, StatusUp, StatusUp, StatusDown}},
+		{"recovery needs successes", 1, 2, "FSFSS",
+			[]Status{StatusDown, StatusDown, StatusDown, StatusDown, StatusUp}},
+		{"unknown until threshold", 2, 2, "SFS",
+			[]Status{StatusUnknown, StatusUnknown, StatusUnknown}},
+	}
+
+	for _, tt := range stateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newStateTracker()
+			tracker.setThresholds(tt.failuresBeforeDown, tt.successesBeforeUp)
+			states := feedResults(tracker, tt.outcomes)
+			for i, state := range states {
+				if state.Status != tt.want[i] {
+					t.Errorf("After %q got %s, wanted %s", tt.outcomes[:i+1], state.Status, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStateTrackerTransitions(t *testing.T) {
+	tracker := newStateTracker()
+	states := feedResults(tracker, "SSF")
+
+	if !states[0].Changed || states[0].Previous != StatusUnknown || states[0].LastUp.IsZero() {
+		t.Errorf("First success should move unknown -> up, got: %+v", states[0])
+	}
+	if states[1].Changed || states[1].ConsecutiveSuccesses != 2 {
+		t.Errorf("Second success should not be a transition, got: %+v", states[1])
+	}
+	down := states[2]
+	if !down.Changed || down.Previous != StatusUp || down.Status != StatusDown {
+		t.Errorf("Failure should move up -> down, got: %+v", down)
+	}
+	if !down.Since.Equal(down.LastDown) || !down.LastUp.Equal(states[0].Since) {
+		t.Errorf("Transition timestamps not tracked, got: %+v", down)
+	}
+}
+
+func TestStateTrackerFlapping(t *testing.T) {
+	tracker := newStateTracker()
+	states := feedResults(tracker, "SFSFSFS")
+	if last := states[len(states)-1]; last.Status != StatusFlapping {
+		t.Errorf("Alternating results should be flapping, got: %s", last.Status)
+	}
+
+	states = feedResults(tracker, "SSSSSSS")
+	if last := states[len(states)-1]; last.Status != StatusUp {
+		t.Errorf("Stable results should stop flapping, got: %s", last.Status)
+	}
+}
+
+func TestStateTrackerRestore(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+	tracker := newStateTracker()
+	tracker.restore([]HistoryEntry{
+		{Timestamp: at(0), Result: Success, Status: StatusUp},
+		{Timestamp: at(1), Result: Failure, Status: StatusDown},
+		{Timestamp: at(2), Result: Success, Status: StatusUp},
+		{Timestamp: at(3), Result: Failure, Status: StatusDown},
+		{Timestamp: at(4), Result: Failure, Status: StatusDown, Message: "refused"},
+	})
+
+	state := tracker.current()
+	if state.Status != StatusDown || state.Previous != StatusUp || !state.Since.Equal(at(3)) {
+		t.Errorf("Unexpected restored status: %+v", state)
+	}
+	if !state.LastUp.Equal(at(2)) || !state.LastDown.Equal(at(3)) {
+		t.Errorf("Unexpected restored transitions: %+v", state)
+	}
+	if state.ConsecutiveFailures != 2 || state.ConsecutiveSuccesses != 0 {
+		t.Errorf("Unexpected restored counters: %+v", state)
+	}
+	if last := tracker.lastResult(); last == nil || last.Message != "refused" {
+		t.Errorf("Unexpected restored last result: %+v", last)
+	}
+
+	state = tracker.update(&Result{Timestamp: at(5), Result: Success})
+	if state.Status != StatusUp || !state.Changed {
+		t.Errorf("Restored tracker should continue from the restored state: %+v", state)
+	}
+}
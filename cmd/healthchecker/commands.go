@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	hchecker "github.com/sirmackk/healthchecker"
+)
+
+const (
+	exitOK            = 0
+	exitChecksFailed  = 1
+	exitInvalidConfig = 2
+	exitError         = 3
+)
+
+func runCommand(cfgFilePath string, skipInvalid bool) int {
+	config, registry, err := loadRegistry(cfgFilePath, skipInvalid, true)
+	if err != nil {
+		logConfigError(err)
+		return exitInvalidConfig
+	}
+	if statusAddr, ok := config.Core["StatusAddr"]; ok {
+		statusHandler := hchecker.NewStatusHandler(registry)
+		if title, ok := config.Core["StatusPageTitle"]; ok {
+			statusHandler.Page.Title = title
+		}
+		statusHandler.SilenceToken = config.Core["SilenceToken"]
+		statusServer, err := hchecker.NewStatusServer(statusAddr, statusHandler)
+		if err != nil {
+			log.Error(err)
+			registry.CloseSinks()
+			return exitError
+		}
+		log.Infof("Serving check status on %s", statusServer.Addr())
+		defer statusServer.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				reloadConfig(cfgFilePath, registry)
+				continue
+			}
+			log.Infof("Received %s, shutting down", sig)
+			cancel()
+			return
+		}
+	}()
+	registry.StartRunning(ctx)
+	log.Info("Shutdown complete")
+	return exitOK
+}
+
+func validateCommand(cfgFilePath string, skipInvalid bool) int {
+	_, registry, err := loadRegistry(cfgFilePath, skipInvalid, false)
+	if err != nil {
+		logConfigError(err)
+		return exitInvalidConfig
+	}
+	fmt.Printf("%s: %d health checks OK\n", cfgFilePath, len(registry.Checks))
+	return exitOK
+}
+
+func runOnceCommand(cfgFilePath string, skipInvalid bool) int {
+	_, registry, err := loadRegistry(cfgFilePath, skipInvalid, false)
+	if err != nil {
+		logConfigError(err)
+		return exitInvalidConfig
+	}
+
+	results := registry.RunOnce(context.Background())
+	exitCode := exitOK
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tTYPE\tRESULT\tDURATION\tMESSAGE")
+	for i, chk := range registry.Checks {
+		res := results[i]
+		if res.Result != hchecker.Success {
+			exitCode = exitChecksFailed
+		}
+		message := res.Message
+		if res.Category != hchecker.CategoryNone {
+			message = fmt.Sprintf("[%s] %s", res.Category, message)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+			chk.Name, chk.Type, res.Result, res.Duration.Round(time.Millisecond), message)
+	}
+	table.Flush()
+	return exitCode
+}
+
+func printSchemas(table *tabwriter.Writer, schemas map[string]hchecker.ArgSchema) {
+	types := make([]string, 0, len(schemas))
+	for typeName := range schemas {
+		types = append(types, typeName)
+	}
+	sort.Strings(types)
+	for _, typeName := range types {
+		schema := schemas[typeName]
+		fmt.Fprintf(table, "  %s\n", typeName)
+		for _, arg := range schema.Args {
+			requirement := "optional"
+			if arg.Required {
+				requirement = "required"
+			}
+			description := arg.Description
+			if arg.Default != "" {
+				description = fmt.Sprintf("%s (default: %s)", description, arg.Default)
+			}
+			fmt.Fprintf(table, "    %s\t%s\t%s\t%s\n", arg.Name, arg.Type, requirement, description)
+		}
+		if schema.ForwardTo != "" {
+			fmt.Fprintf(table, "    ...\t\t\tany args of the '%s' sink type\n", schema.ForwardTo)
+		}
+	}
+}
+
+func listTypesCommand() int {
+	registry := hchecker.NewRegistry()
+	populateRegistry(&hchecker.Config{}, registry)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "Check types:")
+	printSchemas(table, registry.CheckSchemas)
+	fmt.Fprintln(table, "\nSink types (all sinks also accept 'id'):")
+	printSchemas(table, registry.SinkSchemas)
+	table.Flush()
+	return exitOK
+}
+
+// reportCommand prints the uptime of every check in the config from the
+// history in HistoryDir. It only reads the history, so it can run alongside
+// a running healthchecker.
+func reportCommand(cfgFilePath, from, to, format string) int {
+	config, err := setupConfig(cfgFilePath)
+	if err != nil {
+		log.Error(err)
+		return exitInvalidConfig
+	}
+	historyDir, ok := config.Core["HistoryDir"]
+	if !ok {
+		log.Error("Reports need check history, set HistoryDir in the core config")
+		return exitInvalidConfig
+	}
+	start, end, err := hchecker.ReportWindow(from, to, time.Now())
+	if err != nil {
+		log.Error(err)
+		return exitError
+	}
+	history, err := hchecker.OpenDiskHistoryReadOnly(historyDir)
+	if err != nil {
+		log.Error(err)
+		return exitError
+	}
+	defer history.Close()
+
+	reports := make([]hchecker.UptimeReport, 0, len(config.HealthChecks))
+	for _, conf := range config.HealthChecks {
+		schedule, err := hchecker.ScheduleFromConfig(conf)
+		if err != nil {
+			log.Errorf("Invalid schedule of %s: %s", conf.Name, err)
+			return exitInvalidConfig
+		}
+		interval := hchecker.ScheduleInterval(schedule, time.Now())
+		report, err := hchecker.UptimeFromHistory(history, conf.Name, interval, start, end)
+		if err != nil {
+			log.Errorf("Error reading history of %s: %s", conf.Name, err)
+			return exitError
+		}
+		reports = append(reports, report)
+	}
+	if err := hchecker.WriteUptimeReports(os.Stdout, format, reports); err != nil {
+		log.Error(err)
+		return exitError
+	}
+	return exitOK
+}
+
+// statusURL is the URL of path on the status API of a healthchecker running
+// with config, reached over loopback when it listens on every address.
+func statusURL(config *hchecker.Config, path string) (string, error) {
+	statusAddr, ok := config.Core["StatusAddr"]
+	if !ok {
+		return "", fmt.Errorf("Silences need the status API, set StatusAddr in the core config")
+	}
+	host, port, err := net.SplitHostPort(statusAddr)
+	if err != nil {
+		return "", fmt.Errorf("Invalid StatusAddr '%s': %s", statusAddr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port), path), nil
+}
+
+func printSilences(silences []hchecker.Silence) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tEXPIRES\tSCOPE\tCOMMENT")
+	for _, silence := range silences {
+		scope := "all checks"
+		if !silence.All {
+			parts := make([]string, 0, 3)
+			if len(silence.Checks) > 0 {
+				parts = append(parts, "checks="+strings.Join(silence.Checks, ","))
+			}
+			if len(silence.Types) > 0 {
+				parts = append(parts, "types="+strings.Join(silence.Types, ","))
+			}
+			if len(silence.Tags) > 0 {
+				parts = append(parts, "tags="+strings.Join(silence.Tags, ","))
+			}
+			scope = strings.Join(parts, " ")
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", silence.ID, silence.Expires.Format(time.RFC3339), scope, silence.Comment)
+	}
+	table.Flush()
+}
+
+// silenceCommand lists, expires or creates silences through the status API
+// of the healthchecker running with the config.
+func silenceCommand(cfgFilePath string, request hchecker.SilenceRequest, list bool, expire string) int {
+	config, err := setupConfig(cfgFilePath)
+	if err != nil {
+		log.Error(err)
+		return exitInvalidConfig
+	}
+	path := "/silences"
+	method := http.MethodGet
+	var body []byte
+	switch {
+	case expire != "":
+		path, method = "/silences/"+expire, http.MethodDelete
+	case !list:
+		method = http.MethodPost
+		if body, err = json.Marshal(request); err != nil {
+			log.Error(err)
+			return exitError
+		}
+	}
+	url, err := statusURL(config, path)
+	if err != nil {
+		log.Error(err)
+		return exitInvalidConfig
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		log.Error(err)
+		return exitError
+	}
+	if token, ok := config.Core["SilenceToken"]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Errorf("Error reaching the status API: %s", err)
+		return exitError
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		apiErr := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		log.Errorf("Status API responded with %s: %s", resp.Status, apiErr["error"])
+		return exitError
+	}
+
+	switch method {
+	case http.MethodGet:
+		silences := make([]hchecker.Silence, 0)
+		if err := json.NewDecoder(resp.Body).Decode(&silences); err != nil {
+			log.Errorf("Error reading silences: %s", err)
+			return exitError
+		}
+		printSilences(silences)
+	case http.MethodPost:
+		var silence hchecker.Silence
+		if err := json.NewDecoder(resp.Body).Decode(&silence); err != nil {
+			log.Errorf("Error reading the new silence: %s", err)
+			return exitError
+		}
+		fmt.Printf("Created silence %s until %s\n", silence.ID, silence.Expires.Format(time.RFC3339))
+	case http.MethodDelete:
+		fmt.Printf("Expired silence %s\n", expire)
+	}
+	return exitOK
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -22,7 +25,7 @@ func setupConfig(cfgFilePath string) (*hchecker.Config, error) {
 	}
 	config, err := hchecker.ConfigFromYaml(contents)
 	if err != nil {
-		return config, fmt.Errorf("Could not parse config file '%s'", cfgFilePath)
+		return config, fmt.Errorf("Could not parse config file '%s': %s", cfgFilePath, err)
 	}
 	return config, nil
 }
@@ -30,26 +33,178 @@ func setupConfig(cfgFilePath string) (*hchecker.Config, error) {
 func populateRegistry(c *hchecker.Config, registry *hchecker.Registry) {
 	httpTimeout, _ := strconv.Atoi(c.Core["HTTPTimeout"])
 	icmpTimeout, _ := strconv.Atoi(c.Core["ICMPTimeout"])
+	tcpTimeout, _ := strconv.Atoi(c.Core["TCPTimeout"])
+	tlsTimeout, _ := strconv.Atoi(c.Core["TLSTimeout"])
+	dnsTimeout, _ := strconv.Atoi(c.Core["DNSTimeout"])
+	execTimeout, _ := strconv.Atoi(c.Core["ExecTimeout"])
 	httpChecker := hchecker.NewHTTPChecker(time.Duration(httpTimeout) * time.Second)
-	registry.CheckConstructors["SimpleHTTPCheck"] = httpChecker.NewSimpleHTTPCheck
-	registry.CheckConstructors["RegexpHTTPCheck"] = httpChecker.NewRegexpHTTPCheck
+	registry.RegisterCheckType("SimpleHTTPCheck", httpChecker.NewSimpleHTTPCheck, hchecker.SimpleHTTPCheckArgs)
+	registry.RegisterCheckType("RegexpHTTPCheck", httpChecker.NewRegexpHTTPCheck, hchecker.RegexpHTTPCheckArgs)
+
+	tcpChecker := hchecker.NewTCPChecker(time.Duration(tcpTimeout) * time.Second)
+	registry.RegisterCheckType("TCPConnectCheck", tcpChecker.NewTCPConnectCheck, hchecker.TCPConnectCheckArgs)
+	tlsChecker := hchecker.NewTLSChecker(time.Duration(tlsTimeout) * time.Second)
+	registry.RegisterCheckType("TLSCertCheck", tlsChecker.NewTLSCertCheck, hchecker.TLSCertCheckArgs)
+	dnsChecker := hchecker.NewDNSChecker(time.Duration(dnsTimeout) * time.Second)
+	registry.RegisterCheckType("DNSCheck", dnsChecker.NewDNSCheck, hchecker.DNSCheckArgs)
+	execChecker := hchecker.NewExecChecker(time.Duration(execTimeout) * time.Second)
+	registry.RegisterCheckType("ExecCheck", execChecker.NewExecCheck, hchecker.ExecCheckArgs)
+	registry.RegisterCheckType("CompositeCheck", registry.NewCompositeCheck, hchecker.CompositeCheckArgs)
 
 	icmpChecker, err := hchecker.NewICMPChecker(time.Duration(icmpTimeout) * time.Second)
 	if err == nil {
-		registry.CheckConstructors["ICMPV4Check"] = icmpChecker.NewICMPV4Check
+		registry.RegisterCheckType("ICMPV4Check", icmpChecker.NewICMPV4Check, hchecker.ICMPV4CheckArgs)
 	} else {
 		log.Errorf("Error initializing ICMPChecker: %s", err)
 	}
 
-	registry.SinkConstructors["FileSink"] = hchecker.NewFileSink
-	registry.SinkConstructors["UDPInfluxSink"] = hchecker.NewUDPInfluxSink
+	registry.RegisterSinkType("FileSink", hchecker.NewFileSink, hchecker.FileSinkArgs)
+	registry.RegisterSinkType("UDPInfluxSink", hchecker.NewUDPInfluxSink, hchecker.UDPInfluxSinkArgs)
+	registry.RegisterSinkType("StateChangeSink", registry.NewStateChangeSink, hchecker.StateChangeSinkArgs)
+	registry.RegisterSinkType("WebhookSink", hchecker.NewWebhookSink, hchecker.WebhookSinkArgs)
+	registry.RegisterSinkType("SLOSink", registry.NewSLOSink, hchecker.SLOSinkArgs)
+	registry.RegisterSinkType("PrometheusSink", hchecker.NewPrometheusSink, hchecker.PrometheusSinkArgs)
+}
+
+func logConfigError(err error) {
+	if configErr, ok := err.(*hchecker.ConfigError); ok {
+		for _, problem := range configErr.Problems {
+			log.Errorf("Invalid config, %s", problem)
+		}
+		return
+	}
+	log.Error(err)
+}
+
+func reloadConfig(cfgFilePath string, registry *hchecker.Registry) {
+	log.Infof("Reloading config from %s", cfgFilePath)
+	config, err := setupConfig(cfgFilePath)
+	if err != nil {
+		log.Errorf("%s, keeping current config", err)
+		return
+	}
+	if err := registry.Reload(config); err != nil {
+		logConfigError(err)
+		log.Error("Keeping current config")
+	}
+}
+
+// setupScheduling applies the default Splay and Jitter of checks.
+func setupScheduling(c *hchecker.Config, registry *hchecker.Registry) error {
+	splay, err := hchecker.ParseSplayMode(c.Core["Splay"])
+	if err != nil {
+		return fmt.Errorf("Invalid core config: %s", err)
+	}
+	registry.Splay = splay
+	if jitterConf, ok := c.Core["Jitter"]; ok {
+		jitter, err := strconv.Atoi(jitterConf)
+		if err != nil || jitter < 0 {
+			return fmt.Errorf("Invalid core config: Jitter must be a number of milliseconds, got: %s", jitterConf)
+		}
+		registry.Jitter = time.Duration(jitter) * time.Millisecond
+	}
+	return nil
+}
+
+// setupHistory stores check history on disk when HistoryDir is set, or in
+// memory for the status page when only StatusAddr is set. Silences are kept
+// in HistoryDir too.
+func setupHistory(c *hchecker.Config, registry *hchecker.Registry) error {
+	historyDays, _ := strconv.Atoi(c.Core["HistoryDays"])
+	retention := time.Duration(historyDays) * 24 * time.Hour
+	if historyDir, ok := c.Core["HistoryDir"]; ok {
+		historyMaxMB, _ := strconv.Atoi(c.Core["HistoryMaxMB"])
+		history, err := hchecker.OpenDiskHistory(historyDir, retention, int64(historyMaxMB)<<20)
+		if err != nil {
+			return err
+		}
+		registry.History = history
+		if err := registry.Maintenance.LoadSilences(filepath.Join(historyDir, "silences.json")); err != nil {
+			return err
+		}
+	} else if _, ok := c.Core["StatusAddr"]; ok {
+		registry.History = hchecker.NewMemoryHistory(retention)
+	}
+	return nil
+}
+
+// loadRegistry reads the config file and creates all of its checks. Only a
+// running healthchecker gets history and sinks, other commands just validate
+// the sink args.
+func loadRegistry(cfgFilePath string, skipInvalid bool, running bool) (*hchecker.Config, *hchecker.Registry, error) {
+	config, err := setupConfig(cfgFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	registry := hchecker.NewRegistry()
+	populateRegistry(config, registry)
+	registry.SkipInvalidChecks = skipInvalid
+	registry.SkipSinks = !running
+	if err := setupScheduling(config, registry); err != nil {
+		return nil, nil, err
+	}
+	if running {
+		if err := setupHistory(config, registry); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := registry.RegisterHealthChecks(config); err != nil {
+		if closer, ok := registry.History.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, nil, err
+	}
+	return config, registry, nil
+}
+
+// splitList splits a comma separated flag value, empty values are nil.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [command] [flags]
+
+Commands:
+  run         run the health checks until interrupted (default)
+  validate    create every check and validate every sink in the config without
+              running them
+  run-once    run every check once, print the results and exit with 1 if any failed
+  list-types  print every check and sink type with its arguments
+  report      print the uptime of every check from the history in HistoryDir
+  silence     silence checks matching -check, -type, -tag or -all for -duration,
+              or -list or -expire silences, through the status API
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
 }
 
 func main() {
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 	var cfgFilePath = flag.String("cfgFilePath", "config.yaml", "Absolute path to yaml config file")
 	var printVersion = flag.Bool("version", false, "Print version")
 	var debug = flag.Bool("debug", false, "Enable debug logging")
-	flag.Parse()
+	var skipInvalid = flag.Bool("skipInvalidChecks", false, "Log and skip invalid checks instead of refusing to start")
+	var reportFrom = flag.String("from", "", "Start of the report window, as RFC3339, YYYY-MM-DD or an age like 30d (default 30d)")
+	var reportTo = flag.String("to", "", "End of the report window, in the same formats as -from (default now)")
+	var reportFormat = flag.String("format", "markdown", "Report format: markdown, csv or json")
+	var silenceChecks = flag.String("check", "", "Comma separated names of the checks to silence")
+	var silenceTypes = flag.String("type", "", "Comma separated types of the checks to silence")
+	var silenceTags = flag.String("tag", "", "Comma separated tags of the checks to silence")
+	var silenceAll = flag.Bool("all", false, "Silence every check")
+	var silenceDuration = flag.String("duration", "1h", "How long the silence lasts")
+	var silenceComment = flag.String("comment", "", "Why the checks are silenced")
+	var listSilences = flag.Bool("list", false, "List the active silences instead of creating one")
+	var expireSilence = flag.String("expire", "", "ID of a silence to expire instead of creating one")
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
 
 	if *printVersion {
 		log.Infof("Version: %s", version)
@@ -57,6 +212,10 @@ func main() {
 	}
 
 	log.SetLevel(log.InfoLevel)
+	if command != "run" {
+		// Only problems are interesting when not running as a service.
+		log.SetLevel(log.WarnLevel)
+	}
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp: true,
 	})
@@ -65,13 +224,32 @@ func main() {
 		log.SetLevel(log.DebugLevel)
 	}
 
-	config, err := setupConfig(*cfgFilePath)
-	if err != nil {
-		log.Error(err)
-		os.Exit(1)
+	switch command {
+	case "run":
+		os.Exit(runCommand(*cfgFilePath, *skipInvalid))
+	case "validate":
+		os.Exit(validateCommand(*cfgFilePath, *skipInvalid))
+	case "run-once":
+		os.Exit(runOnceCommand(*cfgFilePath, *skipInvalid))
+	case "list-types":
+		os.Exit(listTypesCommand())
+	case "report":
+		os.Exit(reportCommand(*cfgFilePath, *reportFrom, *reportTo, *reportFormat))
+	case "silence":
+		request := hchecker.SilenceRequest{
+			MaintenanceScope: hchecker.MaintenanceScope{
+				Checks: splitList(*silenceChecks),
+				Types:  splitList(*silenceTypes),
+				Tags:   splitList(*silenceTags),
+			},
+			All:      *silenceAll,
+			Comment:  *silenceComment,
+			Duration: *silenceDuration,
+		}
+		os.Exit(silenceCommand(*cfgFilePath, request, *listSilences, *expireSilence))
+	default:
+		log.Errorf("Unknown command: %s", command)
+		flag.Usage()
+		os.Exit(2)
 	}
-	registry := hchecker.NewRegistry()
-	populateRegistry(config, registry)
-	registry.RegisterHealthChecks(config)
-	registry.StartRunning()
 }
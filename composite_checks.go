@@ -0,0 +1,306 @@
+package healthchecker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compositeNode is a node of a composite check expression, either the name
+// of a check or a node passing when at least min of its children pass. and
+// and or are the special cases of all and one of the children.
+type compositeNode struct {
+	check    string
+	min      int
+	children []*compositeNode
+}
+
+func (n *compositeNode) eval(passing map[string]bool) bool {
+	if n.children == nil {
+		return passing[n.check]
+	}
+	passed := 0
+	for _, child := range n.children {
+		if child.eval(passing) {
+			passed++
+		}
+	}
+	return passed >= n.min
+}
+
+// checks appends the names of the checks in the expression to names,
+// without duplicates.
+func (n *compositeNode) checks(names []string) []string {
+	if n.children == nil {
+		if !contains(names, n.check) {
+			names = append(names, n.check)
+		}
+		return names
+	}
+	for _, child := range n.children {
+		names = child.checks(names)
+	}
+	return names
+}
+
+func tokenizeComposite(expr string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(expr); {
+		switch char := expr[i]; {
+		case char == ' ' || char == '\t' || char == '\n':
+			i++
+		case char == '(' || char == ')' || char == ',':
+			tokens = append(tokens, string(char))
+			i++
+		case char == '\'':
+			end := strings.IndexByte(expr[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %s", expr)
+			}
+			// Quoted names keep their quote so they're never keywords.
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		default:
+			end := strings.IndexAny(expr[i:], " \t\n(),'")
+			if end < 0 {
+				end = len(expr) - i
+			}
+			tokens = append(tokens, expr[i:i+end])
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// compositeParser parses composite check expressions:
+//
+//	expr  = and { "or" and }
+//	and   = unary { "and" unary }
+//	unary = name | "(" expr ")" | number "of" "(" expr { "," expr } ")"
+type compositeParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *compositeParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *compositeParser) keyword(word string) bool {
+	if strings.EqualFold(p.peek(), word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *compositeParser) expect(token string) error {
+	if p.peek() != token {
+		return fmt.Errorf("expected '%s' at '%s'", token, p.rest())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *compositeParser) rest() string {
+	if p.pos >= len(p.tokens) {
+		return "end of expression"
+	}
+	return strings.Join(p.tokens[p.pos:], " ")
+}
+
+// list parses expressions separated by word, returning a node requiring
+// the required number of them, or the only expression if there's just one.
+func (p *compositeParser) list(word string, parse func() (*compositeNode, error), required func(count int) int) (*compositeNode, error) {
+	first, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	children := []*compositeNode{first}
+	for p.keyword(word) {
+		next, err := parse()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &compositeNode{min: required(len(children)), children: children}, nil
+}
+
+func (p *compositeParser) expr() (*compositeNode, error) {
+	return p.list("or", p.and, func(int) int { return 1 })
+}
+
+func (p *compositeParser) and() (*compositeNode, error) {
+	return p.list("and", p.unary, func(count int) int { return count })
+}
+
+func (p *compositeParser) unary() (*compositeNode, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		p.pos++
+		node, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	case token == ")" || token == "," || strings.EqualFold(token, "and") || strings.EqualFold(token, "or"):
+		return nil, fmt.Errorf("expected a check name at '%s'", p.rest())
+	}
+	p.pos++
+	if required, err := strconv.Atoi(token); err == nil && p.keyword("of") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		node := &compositeNode{min: required}
+		for {
+			child, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+			if p.peek() != "," {
+				break
+			}
+			p.pos++
+		}
+		if required < 1 || required > len(node.children) {
+			return nil, fmt.Errorf("'%d of' needs between 1 and %d expressions", required, len(node.children))
+		}
+		return node, p.expect(")")
+	}
+	return &compositeNode{check: strings.Trim(token, "'")}, nil
+}
+
+// parseCompositeExpr parses an expression combining the results of checks,
+// eg. "primary or failover" or "2 of (replica1, replica2, replica3)". and
+// binds tighter than or, and names that contain spaces or are keywords can
+// be quoted with single quotes.
+func parseCompositeExpr(expr string) (*compositeNode, error) {
+	tokens, err := tokenizeComposite(expr)
+	if err != nil {
+		return nil, err
+	}
+	parser := &compositeParser{tokens: tokens}
+	node, err := parser.expr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", parser.rest())
+	}
+	return node, nil
+}
+
+// checkRef is a check named in the check expression arg of another check.
+type checkRef struct {
+	arg   string
+	check string
+}
+
+// checkRefs returns the checks named in the check expression args of args.
+// Expressions that don't parse are skipped, they're reported by Validate.
+func (s ArgSchema) checkRefs(args map[string]string) []checkRef {
+	refs := make([]checkRef, 0)
+	for _, spec := range s.Args {
+		value, ok := args[spec.Name]
+		if spec.Type != ArgCheckExpr || !ok {
+			continue
+		}
+		expr, err := parseCompositeExpr(value)
+		if err != nil {
+			continue
+		}
+		for _, name := range expr.checks(nil) {
+			refs = append(refs, checkRef{arg: spec.Name, check: name})
+		}
+	}
+	return refs
+}
+
+// runResults holds the results of the checks run by Registry.RunOnce, which
+// composite checks combine instead of the checks' last results.
+type runResults struct {
+	mu      sync.Mutex
+	results map[string]*Result
+}
+
+type runResultsKey struct{}
+
+func (r *runResults) set(name string, res *Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[name] = res
+}
+
+// latestResult returns the result of chk in the run of ctx, if there's one,
+// or its last result otherwise.
+func latestResult(ctx context.Context, chk *HealthCheck) *Result {
+	if run, ok := ctx.Value(runResultsKey{}).(*runResults); ok {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		return run.results[chk.Name]
+	}
+	return chk.LastResult()
+}
+
+var CompositeCheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "expr", Type: ArgCheckExpr, Required: true, Description: "names of other checks combined with and, or, parentheses and 'N of (a, b, c)'"},
+}}
+
+// NewCompositeCheck creates a check that passes while the expression in the
+// 'expr' arg holds for the latest results of the checks it names. The
+// checks aren't run again, a check without a result yet counts as failing.
+func (c *Registry) NewCompositeCheck(args map[string]string) (CheckFunc, error) {
+	exprArg, ok := args["expr"]
+	if !ok {
+		return nil, fmt.Errorf("CompositeCheck missing 'expr' parameter")
+	}
+	expr, err := parseCompositeExpr(exprArg)
+	if err != nil {
+		return nil, fmt.Errorf("CompositeCheck invalid 'expr' %s: %s", exprArg, err)
+	}
+	checks := expr.checks(nil)
+
+	return func(ctx context.Context) *Result {
+		timeStart := time.Now()
+		res := &Result{Timestamp: timeStart, Result: Success}
+		passing := make(map[string]bool, len(checks))
+		failing := make([]string, 0)
+		for _, name := range checks {
+			chk := c.deps.get(name)
+			if chk == nil {
+				res.Fail(Error, CategoryNone, "no check named '%s'", name)
+				return res
+			}
+			last := latestResult(ctx, chk)
+			switch {
+			case last == nil:
+				failing = append(failing, fmt.Sprintf("%s (no result yet)", name))
+			case last.Result != Success:
+				failing = append(failing, fmt.Sprintf("%s (%s)", name, last.Result))
+			default:
+				passing[name] = true
+			}
+		}
+		res.Duration = time.Since(timeStart)
+		res.SetMetric("passing", float64(len(passing)))
+		res.SetMetric("checks", float64(len(checks)))
+		if !expr.eval(passing) {
+			res.Fail(Failure, CategoryNone, "%s doesn't hold, failing: %s", exprArg, strings.Join(failing, ", "))
+		}
+		return res
+	}, nil
+}
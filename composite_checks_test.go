@@ -0,0 +1,174 @@
+package healthchecker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCompositeExpr(t *testing.T) {
+	exprTests := []struct {
+		name    string
+		expr    string
+		checks  []string
+		passing []string
+		holds   bool
+		succeed bool
+	}{
+		{"or", "primary or failover", []string{"primary", "failover"}, []string{"failover"}, true, true},
+		{"and", "a AND b AND c", []string{"a", "b", "c"}, []string{"a", "b"}, false, true},
+		{"precedence", "a or b and c", []string{"a", "b", "c"}, []string{"b"}, false, true},
+		{"parentheses", "(a or b) and c", []string{"a", "b", "c"}, []string{"b", "c"}, true, true},
+		{"at least", "2 of (r1, r2, r3)", []string{"r1", "r2", "r3"}, []string{"r1", "r3"}, true, true},
+		{"at least failing", "2 of (r1, r2, r3)", []string{"r1", "r2", "r3"}, []string{"r2"}, false, true},
+		{"nested", "lb and 1 of (a and b, c)", []string{"lb", "a", "b", "c"}, []string{"lb", "c"}, true, true},
+		{"quoted", "'core router' or 'and'", []string{"core router", "and"}, []string{"and"}, true, true},
+		{"repeated", "a or (a and b)", []string{"a", "b"}, []string{"a"}, true, true},
+		{"numeric name", "2", []string{"2"}, []string{"2"}, true, true},
+		{"empty", "", nil, nil, false, false},
+		{"dangling or", "a or", nil, nil, false, false},
+		{"unclosed", "(a or b", nil, nil, false, false},
+		{"extra", "a b", nil, nil, false, false},
+		{"too many", "3 of (a, b)", nil, nil, false, false},
+		{"none", "0 of (a, b)", nil, nil, false, false},
+		{"unterminated quote", "'a or b", nil, nil, false, false},
+	}
+
+	for _, tt := range exprTests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseCompositeExpr(tt.expr)
+			if !tt.succeed {
+				if err == nil {
+					t.Errorf("Expected %q to fail", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected %q to parse, got: %s", tt.expr, err)
+			}
+			if checks := expr.checks(nil); !reflect.DeepEqual(checks, tt.checks) {
+				t.Errorf("Expected checks %q, got %q", tt.checks, checks)
+			}
+			passing := make(map[string]bool)
+			for _, name := range tt.passing {
+				passing[name] = true
+			}
+			if holds := expr.eval(passing); holds != tt.holds {
+				t.Errorf("Expected %q to be %v with %q passing", tt.expr, tt.holds, tt.passing)
+			}
+		})
+	}
+}
+
+func TestCompositeCheck(t *testing.T) {
+	registry := NewRegistry()
+	results := map[string]ResultCode{"primary": Failure, "failover": Success}
+	registry.CheckConstructors["result"] = func(args map[string]string) (CheckFunc, error) {
+		name := args["name"]
+		return func(_ context.Context) *Result {
+			return &Result{Timestamp: time.Now(), Result: results[name]}
+		}, nil
+	}
+	registry.CheckConstructors["CompositeCheck"] = registry.NewCompositeCheck
+	checks := make(map[string]*HealthCheck)
+	for _, name := range []string{"primary", "failover", "backup"} {
+		chk, err := registry.AddCheck(name, "result", map[string]string{"name": name}, 5, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks[name] = chk
+	}
+	service, err := registry.AddCheck("service", "CompositeCheck", map[string]string{"expr": "primary or failover"}, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := registry.AddCheck("all", "CompositeCheck", map[string]string{"expr": "primary and failover and backup"}, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := all.Check(context.Background())
+	if res.Result != Failure || res.Message != "primary and failover and backup doesn't hold, failing: primary (no result yet), failover (no result yet), backup (no result yet)" {
+		t.Errorf("Expected checks without results to fail, got %s: %s", res.Result, res.Message)
+	}
+
+	checks["primary"].Run(context.Background())
+	checks["failover"].Run(context.Background())
+	if res := service.Check(context.Background()); res.Result != Success || res.Metrics["passing"] != 1 || res.Metrics["checks"] != 2 {
+		t.Errorf("Expected service to pass on failover, got %s: %s %v", res.Result, res.Message, res.Metrics)
+	}
+
+	results["failover"] = Error
+	checks["failover"].Run(context.Background())
+	if res := service.Check(context.Background()); res.Result != Failure || res.Message != "primary or failover doesn't hold, failing: primary (Failure), failover (Error)" {
+		t.Errorf("Expected service to fail, got %s: %s", res.Result, res.Message)
+	}
+
+	unknown, err := registry.AddCheck("unknown", "CompositeCheck", map[string]string{"expr": "primary or nope"}, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := unknown.Check(context.Background()); res.Result != Error || res.Message != "no check named 'nope'" {
+		t.Errorf("Expected an unknown check to be an error, got %s: %s", res.Result, res.Message)
+	}
+
+	if _, err := registry.NewCompositeCheck(map[string]string{"expr": "primary or"}); err == nil {
+		t.Errorf("Expected an invalid expression to fail")
+	}
+	if _, err := registry.NewCompositeCheck(map[string]string{}); err == nil {
+		t.Errorf("Expected a missing expression to fail")
+	}
+}
+
+func TestCompositeCheckConfig(t *testing.T) {
+	registry := newValidatingRegistry()
+	registry.RegisterCheckType("CompositeCheck", registry.NewCompositeCheck, CompositeCheckArgs)
+	config := &Config{HealthChecks: []HealthChecksConfig{
+		{Name: "primary", Type: "testing", Args: map[string]string{"url": "http://example.com"}, Interval: 5},
+		{Name: "service", Type: "CompositeCheck", Args: map[string]string{"expr": "primary or failvoer"}, Interval: 5, Line: 7},
+		{Name: "broken", Type: "CompositeCheck", Args: map[string]string{"expr": "primary or"}, Interval: 5, Line: 11},
+	}}
+	err := registry.ValidateConfig(config)
+	configErr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("Expected a ConfigError, got: %v", err)
+	}
+	expected := []string{
+		"line 7: check 'service': 'expr' names unknown check 'failvoer'",
+		"line 11: check 'broken': 'expr' is not a valid check expression: unexpected end of expression",
+	}
+	if !reflect.DeepEqual(configErr.Problems, expected) {
+		t.Errorf("Got problems %q, wanted %q", configErr.Problems, expected)
+	}
+}
+
+func TestCompositeCheckRunOnce(t *testing.T) {
+	registry := NewRegistry()
+	registry.CheckConstructors["result"] = func(args map[string]string) (CheckFunc, error) {
+		code := Success
+		if args["fail"] == "true" {
+			code = Failure
+		}
+		return func(_ context.Context) *Result { return &Result{Result: code} }, nil
+	}
+	registry.RegisterCheckType("CompositeCheck", registry.NewCompositeCheck, CompositeCheckArgs)
+	// Composites are added first so they'd run before the checks they combine
+	// if RunOnce didn't order them.
+	registry.AddCheck("site", "CompositeCheck", map[string]string{"expr": "service and db"}, 5, nil)
+	registry.AddCheck("service", "CompositeCheck", map[string]string{"expr": "primary or failover"}, 5, nil)
+	registry.AddCheck("primary", "result", map[string]string{"fail": "true"}, 5, nil)
+	registry.AddCheck("failover", "result", nil, 5, nil)
+	registry.AddCheck("db", "result", nil, 5, nil)
+
+	results := registry.RunOnce(context.Background())
+	for i, chk := range registry.Checks {
+		expected := Success
+		if chk.Name == "primary" {
+			expected = Failure
+		}
+		if results[i].Result != expected {
+			t.Errorf("Expected %s to be %s, got %s: %s", chk.Name, expected, results[i].Result, results[i].Message)
+		}
+	}
+}
@@ -1,28 +1,89 @@
 package healthchecker
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"strings"
+
 	"github.com/go-yaml/yaml"
 )
 
+const healthChecksKey = "health-checks:"
+
 type HealthChecksConfig struct {
-	Name     string
-	Type     string
-	Args     map[string]string
-	Sinks    []map[string]map[string]string
-	Interval int
+	Name               string
+	Type               string
+	Args               map[string]string
+	Sinks              []map[string]map[string]string
+	Interval           int
+	Schedule           string
+	Timezone           string
+	ActiveWindows      []string `yaml:"activeWindows"`
+	Timeout            int
+	FailuresBeforeDown int `yaml:"failuresBeforeDown"`
+	SuccessesBeforeUp  int `yaml:"successesBeforeUp"`
+	Retries            int
+	RetryDelay         int `yaml:"retryDelay"` // milliseconds
+	Splay              string
+	Jitter             int // milliseconds
+	Critical           bool
+	Component          string
+	Tags               []string
+	DependsOn          []string `yaml:"dependsOn"`
+	OnUpstreamDown     string   `yaml:"onUpstreamDown"`
+	// Line is where the check starts in the config file, 0 if unknown.
+	Line int `yaml:"-"`
 }
 
 type Config struct {
 	Core         map[string]string
-	HealthChecks []HealthChecksConfig `health-checks`
+	HealthChecks []HealthChecksConfig `yaml:"health-checks"`
+	Maintenance  []MaintenanceConfig
 }
 
 func ConfigFromYaml(fileContents []byte) (*Config, error) {
 	c := Config{}
-	err := yaml.Unmarshal(fileContents, &c)
+	err := yaml.UnmarshalStrict(fileContents, &c)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot create config from yaml: %s", string(fileContents))
+		return nil, fmt.Errorf("Cannot create config from yaml: %s", err)
+	}
+	lines := healthCheckLines(fileContents)
+	if len(lines) == len(c.HealthChecks) {
+		for i := range c.HealthChecks {
+			c.HealthChecks[i].Line = lines[i]
+		}
 	}
 	return &c, nil
 }
+
+// healthCheckLines returns the line each item of the block style
+// health-checks list starts at.
+func healthCheckLines(fileContents []byte) []int {
+	lines := make([]int, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(fileContents))
+	inChecks := false
+	itemIndent := -1
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 && !strings.HasPrefix(trimmed, "-") {
+			inChecks = strings.HasPrefix(trimmed, healthChecksKey)
+			continue
+		}
+		if !inChecks || !strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+		if itemIndent < 0 {
+			itemIndent = indent
+		}
+		if indent == itemIndent {
+			lines = append(lines, lineNo)
+		}
+	}
+	return lines
+}
@@ -19,6 +19,9 @@ func TestSimpleYamlConfigRead(t *testing.T) {
 			map[string]map[string]string{"ConsoleSink": map[string]string{"useStdout": "true"}}) {
 		t.Errorf("Fail: %s\n%v", exampleYaml, config)
 	}
+	if blogCheck.Interval != 5 || blogCheck.Timeout != 2 {
+		t.Errorf("Wrong interval or timeout: %d, %d", blogCheck.Interval, blogCheck.Timeout)
+	}
 }
 
 func TestSimpleYamlConfigReadFailure(t *testing.T) {
@@ -31,3 +34,38 @@ func TestSimpleYamlConfigReadFailure(t *testing.T) {
 		t.Errorf("Was supposed to fail on bad yaml, got: %v", config)
 	}
 }
+
+func TestConfigFromYamlLines(t *testing.T) {
+	configYaml := `---
+core:
+  HTTPTimeout: '10'
+health-checks:
+  # the blog
+  - name: BlogCheck
+    type: SimpleHTTPCheck
+    sinks:
+      - FileSink:
+          path: /tmp/x
+
+  - name: DNSCheck
+    type: DNSCheck
+`
+	config, err := ConfigFromYaml([]byte(configYaml))
+	if err != nil {
+		t.Fatalf("Couldn't read config: %s", err)
+	}
+	if config.HealthChecks[0].Line != 6 || config.HealthChecks[1].Line != 12 {
+		t.Errorf("Wrong check lines: %d, %d", config.HealthChecks[0].Line, config.HealthChecks[1].Line)
+	}
+}
+
+func TestConfigFromYamlUnknownField(t *testing.T) {
+	configYaml := `---
+health-checks:
+  - name: BlogCheck
+    intervall: 5
+`
+	if _, err := ConfigFromYaml([]byte(configYaml)); err == nil {
+		t.Errorf("Expected misspelled field to be rejected")
+	}
+}
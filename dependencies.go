@@ -0,0 +1,146 @@
+package healthchecker
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// UpstreamMode decides what happens to a check while a check it depends on
+// is down.
+type UpstreamMode string
+
+const (
+	// UpstreamMark runs the check and turns its failures into UpstreamDown
+	// results.
+	UpstreamMark UpstreamMode = "mark"
+	// UpstreamSkip doesn't run the check at all.
+	UpstreamSkip UpstreamMode = "skip"
+)
+
+// ParseUpstreamMode parses an upstream mode, an empty value is UpstreamMark.
+func ParseUpstreamMode(value string) (UpstreamMode, error) {
+	switch mode := UpstreamMode(value); mode {
+	case "":
+		return UpstreamMark, nil
+	case UpstreamMark, UpstreamSkip:
+		return mode, nil
+	default:
+		return UpstreamMark, fmt.Errorf("'onUpstreamDown' must be one of mark or skip, got: %s", value)
+	}
+}
+
+// dependencies looks up the checks other checks depend on, or combine in
+// composite checks, by name. It's shared by every check of a registry and
+// updated whenever its checks change.
+type dependencies struct {
+	mu     sync.Mutex
+	checks map[string]*HealthCheck
+}
+
+func newDependencies() *dependencies {
+	return &dependencies{checks: make(map[string]*HealthCheck)}
+}
+
+func (d *dependencies) set(checks []*HealthCheck) {
+	byName := make(map[string]*HealthCheck, len(checks))
+	for _, chk := range checks {
+		byName[chk.Name] = chk
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.checks = byName
+}
+
+func (d *dependencies) get(name string) *HealthCheck {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.checks[name]
+}
+
+// DownDependency returns the name of a check the check depends on, directly or
+// through other checks, that is down. Dependencies that aren't registered,
+// eg. because they were skipped as invalid, are ignored.
+func (h *HealthCheck) DownDependency() (string, bool) {
+	if h.deps == nil {
+		return "", false
+	}
+	for _, name := range h.DependsOn {
+		parent := h.deps.get(name)
+		if parent == nil {
+			continue
+		}
+		if parent.State().Status == StatusDown {
+			return parent.Name, true
+		}
+		if upstream, down := parent.DownDependency(); down {
+			return upstream, true
+		}
+	}
+	return "", false
+}
+
+// dependencyProblems returns the problems with the dependsOn of every check,
+// indexed like checks: unknown checks and dependency cycles.
+func dependencyProblems(checks []HealthChecksConfig) [][]string {
+	problems := make([][]string, len(checks))
+	index := make(map[string]int)
+	for i, conf := range checks {
+		if _, ok := index[conf.Name]; !ok {
+			index[conf.Name] = i
+		}
+	}
+	for i, conf := range checks {
+		for _, name := range conf.DependsOn {
+			if _, ok := index[name]; !ok {
+				problems[i] = append(problems[i], fmt.Sprintf("'dependsOn' names unknown check '%s'", name))
+			}
+		}
+	}
+
+	// A depth first search finds every cycle as a dependency on a check
+	// that's still on the path being searched.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make([]int, len(checks))
+	path := make([]int, 0)
+	var visit func(i int)
+	visit = func(i int) {
+		marks[i] = visiting
+		path = append(path, i)
+		for _, name := range checks[i].DependsOn {
+			j, ok := index[name]
+			if !ok {
+				continue
+			}
+			switch marks[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				start := len(path) - 1
+				for path[start] != j {
+					start--
+				}
+				names := make([]string, 0, len(path)-start+1)
+				for _, k := range path[start:] {
+					names = append(names, checks[k].Name)
+				}
+				cycle := strings.Join(append(names, checks[j].Name), " -> ")
+				for _, k := range path[start:] {
+					problems[k] = append(problems[k], fmt.Sprintf("dependency cycle: %s", cycle))
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		marks[i] = visited
+	}
+	for i := range checks {
+		if marks[i] == unvisited {
+			visit(i)
+		}
+	}
+	return problems
+}
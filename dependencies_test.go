@@ -0,0 +1,137 @@
+package healthchecker
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseUpstreamMode(t *testing.T) {
+	modeTests := []struct {
+		value   string
+		mode    UpstreamMode
+		succeed bool
+	}{
+		{"", UpstreamMark, true},
+		{"mark", UpstreamMark, true},
+		{"skip", UpstreamSkip, true},
+		{"ignore", UpstreamMark, false},
+	}
+
+	for _, tt := range modeTests {
+		mode, err := ParseUpstreamMode(tt.value)
+		if tt.succeed && (err != nil || mode != tt.mode) {
+			t.Errorf("Expected %q to parse as %s, got %s: %v", tt.value, tt.mode, mode, err)
+		} else if !tt.succeed && err == nil {
+			t.Errorf("Expected %q to fail", tt.value)
+		}
+	}
+}
+
+func TestDependencyProblems(t *testing.T) {
+	checks := []HealthChecksConfig{
+		{Name: "router"},
+		{Name: "web", DependsOn: []string{"router", "db"}},
+		{Name: "db", DependsOn: []string{"storage"}},
+		{Name: "storage", DependsOn: []string{"db"}},
+		{Name: "cache", DependsOn: []string{"cache", "nope"}},
+	}
+	expected := [][]string{
+		nil,
+		nil,
+		{"dependency cycle: db -> storage -> db"},
+		{"dependency cycle: db -> storage -> db"},
+		{"'dependsOn' names unknown check 'nope'", "dependency cycle: cache -> cache"},
+	}
+	if problems := dependencyProblems(checks); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Got problems %q, wanted %q", problems, expected)
+	}
+}
+
+func TestRegisterHealthChecksDependencyCycle(t *testing.T) {
+	config := &Config{HealthChecks: []HealthChecksConfig{
+		{Name: "a", Type: "testing", Args: map[string]string{"url": "http://example.com"}, Interval: 5, DependsOn: []string{"b"}},
+		{Name: "b", Type: "testing", Args: map[string]string{"url": "http://example.com"}, Interval: 5, DependsOn: []string{"a"}},
+		{Name: "c", Type: "testing", Args: map[string]string{"url": "http://example.com"}, Interval: 5, DependsOn: []string{"a"}},
+	}}
+
+	registry := newValidatingRegistry()
+	err := registry.RegisterHealthChecks(config)
+	if err == nil || !strings.Contains(err.Error(), "check 'a': dependency cycle: a -> b -> a") {
+		t.Errorf("Expected the dependency cycle to be rejected, got: %v", err)
+	}
+	if len(registry.Checks) != 0 {
+		t.Errorf("Expected no checks to be registered, got: %s", registry.Checks)
+	}
+
+	registry.SkipInvalidChecks = true
+	if err := registry.RegisterHealthChecks(config); err != nil {
+		t.Fatalf("Expected checks in the cycle to be skipped, got: %s", err)
+	}
+	if len(registry.Checks) != 1 || registry.Checks[0].Name != "c" {
+		t.Errorf("Expected only c to be registered, got: %s", registry.Checks)
+	}
+}
+
+func TestHealthCheckRunUpstreamDown(t *testing.T) {
+	registry := NewRegistry()
+	results := map[string]ResultCode{"router": Success, "switch": Success, "web": Success}
+	ran := map[string]int{}
+	registry.CheckConstructors["result"] = func(args map[string]string) (CheckFunc, error) {
+		name := args["name"]
+		return func(_ context.Context) *Result {
+			ran[name]++
+			return &Result{Timestamp: time.Now(), Result: results[name], Message: "unreachable"}
+		}, nil
+	}
+	checks := make(map[string]*HealthCheck)
+	targets := make(map[string]*recordingSink)
+	for _, name := range []string{"router", "switch", "web", "api"} {
+		targets[name] = &recordingSink{}
+		chk, err := registry.AddCheck(name, "result", map[string]string{"name": name}, 5, []Emitter{targets[name]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks[name] = chk
+	}
+	checks["switch"].DependsOn = []string{"router"}
+	checks["web"].DependsOn = []string{"switch"}
+	checks["api"].DependsOn = []string{"switch"}
+	checks["api"].OnUpstreamDown = UpstreamSkip
+	runAll := func() {
+		for _, name := range []string{"router", "switch", "web", "api"} {
+			checks[name].Run(context.Background())
+		}
+	}
+
+	runAll()
+	if status := checks["web"].State().Status; status != StatusUp {
+		t.Fatalf("Expected web to be up, got %s", status)
+	}
+
+	results["router"], results["switch"], results["web"], results["api"] = Failure, Failure, Failure, Failure
+	runAll()
+	for _, name := range []string{"switch", "web"} {
+		last := targets[name].Results()[1]
+		if last.Result != UpstreamDown || last.Message != "router is down: unreachable" {
+			t.Errorf("Expected %s to be marked upstream down, got %s: %s", name, last.Result, last.Message)
+		}
+		if status := checks[name].State().Status; status != StatusUp {
+			t.Errorf("Expected %s to stay up while upstream is down, got %s", name, status)
+		}
+	}
+	if ran["api"] != 1 || len(targets["api"].Results()) != 1 {
+		t.Errorf("Expected api to be skipped while upstream is down, ran %d times", ran["api"])
+	}
+
+	results["router"], results["switch"] = Success, Success
+	runAll()
+	if last := targets["web"].Results()[2]; last.Result != Failure {
+		t.Errorf("Expected web to fail once upstream is back, got %s", last.Result)
+	}
+	if status := checks["web"].State().Status; status != StatusDown {
+		t.Errorf("Expected web to be down once upstream is back, got %s", status)
+	}
+}
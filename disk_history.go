@@ -0,0 +1,471 @@
+package healthchecker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSegmentBytes = 8 << 20
+	segmentMaxAge       = hoursInDay * time.Hour
+	segmentLogExt       = ".log"
+	segmentIndexExt     = ".idx"
+	// Every checkIndexEvery'th record of a check is marked in the index.
+	checkIndexEvery = 64
+)
+
+// diskRecord is how a HistoryEntry is stored, one JSON object per line.
+type diskRecord struct {
+	Name      string        `json:"n"`
+	Timestamp int64         `json:"t"`
+	Result    ResultCode    `json:"r"`
+	Duration  time.Duration `json:"d"`
+	Message   string        `json:"m,omitempty"`
+	Category  ErrorCategory `json:"c,omitempty"`
+	Status    Status        `json:"s"`
+	// Maintenance is left out when false to keep records small.
+	Maintenance bool `json:"mt,omitempty"`
+}
+
+// segmentIndex describes the contents of a segment so queries can skip it,
+// or seek to the records of a check in it. It's written next to the segment
+// once the segment is sealed.
+type segmentIndex struct {
+	First  time.Time              `json:"first"`
+	Last   time.Time              `json:"last"`
+	Checks map[string]*checkIndex `json:"checks"`
+	Size   int64                  `json:"size"`
+}
+
+// checkIndex locates the records of one check in a segment. The records of a
+// check are appended in time order, Marks holds the timestamp and offset of
+// every checkIndexEvery'th one and End is where the last one ends.
+type checkIndex struct {
+	First time.Time   `json:"first"`
+	Last  time.Time   `json:"last"`
+	Count int         `json:"count"`
+	Marks []indexMark `json:"marks"`
+	End   int64       `json:"end"`
+}
+
+type indexMark struct {
+	Timestamp int64 `json:"t"`
+	Offset    int64 `json:"o"`
+}
+
+// span returns the part of the segment holding the records of the check
+// from from up to to.
+func (c *checkIndex) span(from, to time.Time) (start, end int64) {
+	end = c.End
+	for _, mark := range c.Marks {
+		if !from.IsZero() && mark.Timestamp <= from.UnixNano() {
+			start = mark.Offset
+		}
+		if !to.IsZero() && mark.Timestamp >= to.UnixNano() {
+			return start, mark.Offset
+		}
+	}
+	if start == 0 && len(c.Marks) > 0 {
+		start = c.Marks[0].Offset
+	}
+	return start, end
+}
+
+type segment struct {
+	id int
+	segmentIndex
+}
+
+func newSegment(id int) *segment {
+	return &segment{id: id, segmentIndex: segmentIndex{Checks: make(map[string]*checkIndex)}}
+}
+
+// add indexes rec, written at the end of the segment.
+func (s *segment) add(rec *diskRecord, size int64) {
+	ts := time.Unix(0, rec.Timestamp)
+	if s.First.IsZero() || ts.Before(s.First) {
+		s.First = ts
+	}
+	if ts.After(s.Last) {
+		s.Last = ts
+	}
+	check, ok := s.Checks[rec.Name]
+	if !ok {
+		check = &checkIndex{First: ts}
+		s.Checks[rec.Name] = check
+	}
+	if ts.Before(check.First) {
+		check.First = ts
+	}
+	if ts.After(check.Last) {
+		check.Last = ts
+	}
+	if check.Count%checkIndexEvery == 0 {
+		check.Marks = append(check.Marks, indexMark{Timestamp: rec.Timestamp, Offset: s.Size})
+	}
+	check.Count++
+	s.Size += size
+	check.End = s.Size
+}
+
+// DiskHistory is a History stored in an append-only log of segments in Dir.
+// Segments are rolled once they reach SegmentBytes or are a day old, and
+// whole segments are dropped once they are older than Retention or the log
+// grows past MaxBytes.
+type DiskHistory struct {
+	Dir          string
+	Retention    time.Duration
+	MaxBytes     int64
+	SegmentBytes int64
+	readOnly     bool
+	mu           sync.Mutex
+	segments     []*segment
+	active       *os.File
+}
+
+func OpenDiskHistory(dir string, retention time.Duration, maxBytes int64) (*DiskHistory, error) {
+	if retention <= 0 {
+		retention = defaultHistoryRetention
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("Error opening history - cannot create %s: %s", dir, err)
+	}
+	d := &DiskHistory{
+		Dir:          dir,
+		Retention:    retention,
+		MaxBytes:     maxBytes,
+		SegmentBytes: defaultSegmentBytes,
+	}
+	if err := d.load(); err != nil {
+		return nil, fmt.Errorf("Error opening history in %s: %s", dir, err)
+	}
+	d.enforceRetention(time.Now())
+	return d, nil
+}
+
+// OpenDiskHistoryReadOnly opens the history in dir for queries only, so it
+// can be read while another healthchecker is recording to it.
+func OpenDiskHistoryReadOnly(dir string) (*DiskHistory, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("Error opening history: %s", err)
+	}
+	d := &DiskHistory{Dir: dir, readOnly: true}
+	if err := d.load(); err != nil {
+		return nil, fmt.Errorf("Error opening history in %s: %s", dir, err)
+	}
+	return d, nil
+}
+
+func (d *DiskHistory) segmentPath(id int, ext string) string {
+	return filepath.Join(d.Dir, fmt.Sprintf("%08d%s", id, ext))
+}
+
+func (d *DiskHistory) load() error {
+	files, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), segmentLogExt) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(file.Name(), segmentLogExt))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for i, id := range ids {
+		last := i == len(ids)-1
+		seg, err := d.loadSegment(id, last)
+		if err != nil {
+			return err
+		}
+		d.segments = append(d.segments, seg)
+	}
+	if d.readOnly {
+		return nil
+	}
+	if len(d.segments) == 0 {
+		return d.roll()
+	}
+	active := d.segments[len(d.segments)-1]
+	d.active, err = os.OpenFile(d.segmentPath(active.id, segmentLogExt), os.O_WRONLY|os.O_APPEND, 0640)
+	return err
+}
+
+// loadSegment reads the index of a sealed segment, or rebuilds it by scanning
+// the segment. A partially written last record, one without a newline, is
+// cut.
+func (d *DiskHistory) loadSegment(id int, active bool) (*segment, error) {
+	seg := newSegment(id)
+	logPath := d.segmentPath(id, segmentLogExt)
+	if !active {
+		if contents, err := ioutil.ReadFile(d.segmentPath(id, segmentIndexExt)); err == nil {
+			// Indexes written before checks were indexed are rebuilt.
+			if err := json.Unmarshal(contents, &seg.segmentIndex); err == nil && seg.Checks != nil {
+				if info, err := os.Stat(logPath); err == nil && info.Size() == seg.Size {
+					return seg, nil
+				}
+			}
+		}
+		if !d.readOnly {
+			log.Infof("Rebuilding index of history segment %s", logPath)
+		}
+		seg = newSegment(id)
+	}
+
+	size, corrupt, err := d.scanSegment(id, 0, -1, func(rec *diskRecord, offset, size int64) bool {
+		// Corrupt records are kept, so offsets match the file.
+		seg.Size = offset
+		seg.add(rec, size)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if corrupt > 0 {
+		log.Errorf("Skipped %d corrupt records in history segment %s", corrupt, logPath)
+	}
+	seg.Size = size
+	if d.readOnly {
+		return seg, nil
+	}
+	if info, err := os.Stat(logPath); err == nil && info.Size() != seg.Size {
+		log.Warnf("Truncating partially written history segment %s to %d bytes", logPath, seg.Size)
+		if err := os.Truncate(logPath, seg.Size); err != nil {
+			return nil, err
+		}
+	}
+	if !active {
+		d.writeIndex(seg)
+	}
+	return seg, nil
+}
+
+// scanSegment calls fn with every complete record in the segment from offset
+// start up to end, or the end of the segment if end is negative, until fn
+// returns false. Lines that aren't valid records are skipped. It returns the
+// offset the complete lines read end at and how many of them were skipped.
+func (d *DiskHistory) scanSegment(id int, start, end int64, fn func(rec *diskRecord, offset, size int64) bool) (offset int64, corrupt int, err error) {
+	f, err := os.Open(d.segmentPath(id, segmentLogExt))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if start > 0 {
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+	}
+	if end >= 0 {
+		r = io.LimitReader(f, end-start)
+	}
+	reader := bufio.NewReader(r)
+	offset = start
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A line without a newline is a partial write.
+			return offset, corrupt, nil
+		}
+		lineOffset := offset
+		offset += int64(len(line))
+		rec := &diskRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			log.Debugf("Skipping corrupt record in history segment %d: %s", id, err)
+			corrupt++
+			continue
+		}
+		if !fn(rec, lineOffset, int64(len(line))) {
+			return offset, corrupt, nil
+		}
+	}
+}
+
+func (d *DiskHistory) writeIndex(seg *segment) {
+	contents, err := json.Marshal(seg.segmentIndex)
+	if err == nil {
+		err = ioutil.WriteFile(d.segmentPath(seg.id, segmentIndexExt), contents, 0640)
+	}
+	if err != nil {
+		log.Errorf("Error writing index of history segment %d: %s", seg.id, err)
+	}
+}
+
+// roll seals the active segment and starts a new one.
+func (d *DiskHistory) roll() error {
+	id := 1
+	if len(d.segments) > 0 {
+		sealed := d.segments[len(d.segments)-1]
+		id = sealed.id + 1
+		d.writeIndex(sealed)
+	}
+	if d.active != nil {
+		d.active.Close()
+	}
+	f, err := os.OpenFile(d.segmentPath(id, segmentLogExt), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	d.active = f
+	d.segments = append(d.segments, newSegment(id))
+	return nil
+}
+
+func (d *DiskHistory) removeSegment(seg *segment) {
+	log.Debugf("Dropping history segment %d", seg.id)
+	os.Remove(d.segmentPath(seg.id, segmentLogExt))
+	os.Remove(d.segmentPath(seg.id, segmentIndexExt))
+}
+
+// enforceRetention drops sealed segments that are too old or don't fit in
+// MaxBytes, oldest first.
+func (d *DiskHistory) enforceRetention(now time.Time) {
+	var total int64
+	for _, seg := range d.segments {
+		total += seg.Size
+	}
+	cutoff := now.Add(-d.Retention)
+	drop := 0
+	for drop < len(d.segments)-1 {
+		seg := d.segments[drop]
+		tooOld := !seg.Last.IsZero() && seg.Last.Before(cutoff)
+		tooBig := d.MaxBytes > 0 && total > d.MaxBytes
+		if !tooOld && !tooBig {
+			break
+		}
+		d.removeSegment(seg)
+		total -= seg.Size
+		drop++
+	}
+	d.segments = d.segments[drop:]
+}
+
+func (d *DiskHistory) Record(name string, entry HistoryEntry) error {
+	rec := &diskRecord{
+		Name:        name,
+		Timestamp:   entry.Timestamp.UnixNano(),
+		Result:      entry.Result,
+		Duration:    entry.Duration,
+		Message:     entry.Message,
+		Category:    entry.Category,
+		Status:      entry.Status,
+		Maintenance: entry.Maintenance,
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.readOnly {
+		return fmt.Errorf("history is read only")
+	}
+	if d.active == nil {
+		return fmt.Errorf("history is closed")
+	}
+	active := d.segments[len(d.segments)-1]
+	if active.Size > 0 && (active.Size+int64(len(line)) > d.SegmentBytes || time.Since(active.First) > segmentMaxAge) {
+		if err := d.roll(); err != nil {
+			return err
+		}
+		d.enforceRetention(time.Now())
+		active = d.segments[len(d.segments)-1]
+	}
+	if _, err := d.active.Write(line); err != nil {
+		return err
+	}
+	active.add(rec, int64(len(line)))
+	return nil
+}
+
+// segmentSpan is the part of a segment to read for a query.
+type segmentSpan struct {
+	id         int
+	start, end int64
+}
+
+// spans returns the parts of the segments holding the records of name from
+// from up to to.
+func (d *DiskHistory) spans(name string, from, to time.Time) []segmentSpan {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	spans := make([]segmentSpan, 0)
+	for _, seg := range d.segments {
+		check, ok := seg.Checks[name]
+		if !ok || check.Last.Before(from) || (!to.IsZero() && !check.First.Before(to)) {
+			continue
+		}
+		start, end := check.span(from, to)
+		spans = append(spans, segmentSpan{id: seg.id, start: start, end: end})
+	}
+	return spans
+}
+
+// Entries reads the records without holding the lock, Record only appends
+// past the indexed records and segments dropped meanwhile are skipped.
+func (d *DiskHistory) Entries(name string, from, to time.Time) ([]HistoryEntry, error) {
+	entries := make([]HistoryEntry, 0)
+	for _, span := range d.spans(name, from, to) {
+		_, _, err := d.scanSegment(span.id, span.start, span.end, func(rec *diskRecord, _, _ int64) bool {
+			if rec.Name != name {
+				return true
+			}
+			ts := time.Unix(0, rec.Timestamp)
+			if ts.Before(from) || (!to.IsZero() && !ts.Before(to)) {
+				return true
+			}
+			entries = append(entries, HistoryEntry{
+				Timestamp:   ts,
+				Result:      rec.Result,
+				Duration:    rec.Duration,
+				Message:     rec.Message,
+				Category:    rec.Category,
+				Status:      rec.Status,
+				Maintenance: rec.Maintenance,
+			})
+			return true
+		})
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries, nil
+}
+
+// Close closes the active segment, it is indexed again on the next open.
+func (d *DiskHistory) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.active == nil {
+		return nil
+	}
+	err := d.active.Close()
+	d.active = nil
+	return err
+}
@@ -0,0 +1,216 @@
+package healthchecker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempHistoryDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "healthchecker-history")
+	if err != nil {
+		t.Fatalf("Couldn't create temp dir: %s", err)
+	}
+	return dir
+}
+
+func TestDiskHistoryRecordAndQuery(t *testing.T) {
+	dir := tempHistoryDir(t)
+	defer os.RemoveAll(dir)
+	start := time.Now().Add(-time.Hour)
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+
+	history, err := OpenDiskHistory(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Couldn't open history: %s", err)
+	}
+	history.SegmentBytes = 512
+	for i := 0; i < 20; i++ {
+		history.Record("web", HistoryEntry{Timestamp: at(i), Result: Success, Duration: time.Millisecond, Status: StatusUp})
+		history.Record("db", HistoryEntry{Timestamp: at(i), Result: Failure, Message: "refused", Status: StatusDown})
+	}
+	if len(history.segments) < 3 {
+		t.Errorf("Expected segments to be rolled, got %d", len(history.segments))
+	}
+
+	entries, err := history.Entries("db", at(5), at(10))
+	if err != nil {
+		t.Fatalf("Couldn't query history: %s", err)
+	}
+	if len(entries) != 5 || !entries[0].Timestamp.Equal(at(5)) || !entries[4].Timestamp.Equal(at(9)) {
+		t.Fatalf("Unexpected range: %+v", entries)
+	}
+	if entries[0].Result != Failure || entries[0].Message != "refused" || entries[0].Status != StatusDown {
+		t.Errorf("Entry not stored faithfully: %+v", entries[0])
+	}
+	history.Close()
+
+	// Reopening uses the sealed indexes and drops a torn last record.
+	f, _ := os.OpenFile(history.segmentPath(history.segments[len(history.segments)-1].id, segmentLogExt), os.O_WRONLY|os.O_APPEND, 0640)
+	f.WriteString(`{"n":"web","t":`)
+	f.Close()
+	history, err = OpenDiskHistory(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Couldn't reopen history: %s", err)
+	}
+	defer history.Close()
+	entries, _ = history.Entries("web", time.Time{}, time.Time{})
+	if len(entries) != 20 {
+		t.Errorf("Expected 20 entries after reopening, got %d", len(entries))
+	}
+	if err := history.Record("web", HistoryEntry{Timestamp: at(30), Result: Success}); err != nil {
+		t.Errorf("Couldn't record after reopening: %s", err)
+	}
+	entries, _ = history.Entries("web", at(20), time.Time{})
+	if len(entries) != 1 {
+		t.Errorf("Expected the new entry after the torn record, got %+v", entries)
+	}
+}
+
+func TestDiskHistoryCorruptRecord(t *testing.T) {
+	dir := tempHistoryDir(t)
+	defer os.RemoveAll(dir)
+	start := time.Now().Add(-time.Hour)
+
+	history, err := OpenDiskHistory(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Couldn't open history: %s", err)
+	}
+	history.Record("web", HistoryEntry{Timestamp: start, Result: Success})
+	path := history.segmentPath(history.segments[0].id, segmentLogExt)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0640)
+	f.WriteString("{\"n\":\"web\",garbage\n")
+	f.Close()
+	history.Record("web", HistoryEntry{Timestamp: start.Add(time.Minute), Result: Failure})
+	history.Close()
+
+	// A corrupt record in the middle is skipped, the ones after it are kept.
+	history, err = OpenDiskHistory(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Couldn't reopen history: %s", err)
+	}
+	defer history.Close()
+	if err := history.Record("web", HistoryEntry{Timestamp: start.Add(2 * time.Minute), Result: Success}); err != nil {
+		t.Fatalf("Couldn't record after reopening: %s", err)
+	}
+	entries, _ := history.Entries("web", time.Time{}, time.Time{})
+	if len(entries) != 3 || entries[1].Result != Failure {
+		t.Errorf("Expected the records around the corrupt one, got %+v", entries)
+	}
+}
+
+func TestDiskHistoryCheckIndex(t *testing.T) {
+	dir := tempHistoryDir(t)
+	defer os.RemoveAll(dir)
+	start := time.Now().Add(-time.Hour)
+	at := func(second int) time.Time { return start.Add(time.Duration(second) * time.Second) }
+
+	history, _ := OpenDiskHistory(dir, 0, 0)
+	for i := 0; i < 3*checkIndexEvery; i++ {
+		history.Record("web", HistoryEntry{Timestamp: at(i), Result: Success})
+		history.Record("db", HistoryEntry{Timestamp: at(i), Result: Failure})
+	}
+	history.Record("late", HistoryEntry{Timestamp: at(1000), Result: Success})
+	web := history.segments[0].Checks["web"]
+	if web.Count != 3*checkIndexEvery || len(web.Marks) != 3 {
+		t.Fatalf("Expected every %dth record to be marked, got %+v", checkIndexEvery, web)
+	}
+
+	// A query seeks to the mark before its range and stops at the one after.
+	from, to := at(2*checkIndexEvery+1), at(2*checkIndexEvery+5)
+	if begin, end := web.span(from, to); begin != web.Marks[2].Offset || end != web.End {
+		t.Errorf("Expected the span from the last mark, got %d - %d", begin, end)
+	}
+	if begin, end := web.span(time.Time{}, at(checkIndexEvery)); begin != 0 || end != web.Marks[1].Offset {
+		t.Errorf("Expected the span up to the second mark, got %d - %d", begin, end)
+	}
+	entries, _ := history.Entries("web", from, to)
+	if len(entries) != 4 || !entries[0].Timestamp.Equal(from) {
+		t.Errorf("Unexpected range: %+v", entries)
+	}
+	if entries, _ := history.Entries("late", time.Time{}, at(999)); len(entries) != 0 {
+		t.Errorf("Expected no entries before the check's first record, got %+v", entries)
+	}
+	history.Close()
+
+	// Indexes from before checks were indexed are rebuilt.
+	history, _ = OpenDiskHistory(dir, 0, 0)
+	history.roll()
+	history.Close()
+	ioutil.WriteFile(history.segmentPath(1, segmentIndexExt), []byte(`{"names":{"web":true}}`), 0640)
+	history, _ = OpenDiskHistory(dir, 0, 0)
+	defer history.Close()
+	if entries, _ := history.Entries("db", time.Time{}, time.Time{}); len(entries) != 3*checkIndexEvery {
+		t.Errorf("Expected the old index to be rebuilt, got %d entries", len(entries))
+	}
+}
+
+func TestDiskHistoryRetention(t *testing.T) {
+	dir := tempHistoryDir(t)
+	defer os.RemoveAll(dir)
+
+	history, _ := OpenDiskHistory(dir, 24*time.Hour, 0)
+	history.SegmentBytes = 256
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 10; i++ {
+		history.Record("web", HistoryEntry{Timestamp: old.Add(time.Duration(i) * time.Second)})
+	}
+	for i := 0; i < 10; i++ {
+		history.Record("web", HistoryEntry{Timestamp: time.Now()})
+	}
+	entries, _ := history.Entries("web", time.Time{}, time.Time{})
+	for _, entry := range entries {
+		if entry.Timestamp.Before(time.Now().Add(-24 * time.Hour)) {
+			t.Fatalf("Expected entries older than retention to be dropped, got one from %s", entry.Timestamp)
+		}
+	}
+	history.Close()
+
+	history, _ = OpenDiskHistory(dir, 24*time.Hour, 600)
+	defer history.Close()
+	var total int64
+	for _, seg := range history.segments {
+		total += seg.Size
+	}
+	if total > 600 && len(history.segments) > 1 {
+		t.Errorf("Expected history to be trimmed to MaxBytes, got %d bytes", total)
+	}
+	logs, _ := filepath.Glob(filepath.Join(dir, "*"+segmentLogExt))
+	if len(logs) != len(history.segments) {
+		t.Errorf("Expected dropped segments to be removed, got %d files for %d segments", len(logs), len(history.segments))
+	}
+}
+
+func TestDiskHistoryReadOnly(t *testing.T) {
+	dir := tempHistoryDir(t)
+	defer os.RemoveAll(dir)
+
+	history, _ := OpenDiskHistory(dir, 0, 0)
+	now := time.Now()
+	history.Record("web", HistoryEntry{Timestamp: now, Status: StatusUp})
+	// A record being written by the running healthchecker.
+	history.active.WriteString(`{"n":"web","t":`)
+	before, _ := os.Stat(history.segmentPath(1, segmentLogExt))
+
+	reader, err := OpenDiskHistoryReadOnly(dir)
+	if err != nil {
+		t.Fatalf("Couldn't open history read only: %s", err)
+	}
+	defer reader.Close()
+	if entries, _ := reader.Entries("web", time.Time{}, time.Time{}); len(entries) != 1 {
+		t.Errorf("Expected 1 entry, got %d", len(entries))
+	}
+	if err := reader.Record("web", HistoryEntry{Timestamp: now}); err == nil {
+		t.Error("Expected recording to a read only history to fail")
+	}
+	history.Close()
+	if after, _ := os.Stat(history.segmentPath(1, segmentLogExt)); after.Size() != before.Size() {
+		t.Errorf("Expected the read only history to leave the segment alone, size went from %d to %d", before.Size(), after.Size())
+	}
+
+	if _, err := OpenDiskHistoryReadOnly(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected opening a missing history to fail")
+	}
+}
@@ -0,0 +1,207 @@
+package healthchecker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	resolvConfPath = "/etc/resolv.conf"
+	defaultDNSPort = "53"
+)
+
+var dnsRecordTypes = map[string]uint16{
+	"A":     dns.TypeA,
+	"AAAA":  dns.TypeAAAA,
+	"CNAME": dns.TypeCNAME,
+	"MX":    dns.TypeMX,
+	"TXT":   dns.TypeTXT,
+}
+
+type DNSChecker struct {
+	Client  *dns.Client
+	Timeout time.Duration
+}
+
+func NewDNSChecker(timeout time.Duration) *DNSChecker {
+	checker := DNSChecker{
+		Client:  &dns.Client{},
+		Timeout: timeout,
+	}
+	return &checker
+}
+
+func normalizeDNSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func dnsRecordValue(rr dns.RR) string {
+	switch record := rr.(type) {
+	case *dns.A:
+		return record.A.String()
+	case *dns.AAAA:
+		return record.AAAA.String()
+	case *dns.CNAME:
+		return normalizeDNSName(record.Target)
+	case *dns.MX:
+		return fmt.Sprintf("%d %s", record.Preference, normalizeDNSName(record.Mx))
+	case *dns.TXT:
+		return strings.Join(record.Txt, "")
+	default:
+		return strings.TrimPrefix(rr.String(), rr.Header().String())
+	}
+}
+
+func matchDNSAnswers(values []string, expected []string, rex *regexp.Regexp) bool {
+	if expected != nil {
+		if len(values) != len(expected) {
+			return false
+		}
+		sorted := append([]string(nil), values...)
+		sort.Strings(sorted)
+		for i := range sorted {
+			if sorted[i] != expected[i] {
+				return false
+			}
+		}
+	}
+	if rex != nil {
+		for _, value := range values {
+			if rex.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (d *DNSChecker) DNSCheck(ctx context.Context, nameserver, name string, recordType uint16, expected []string, rex *regexp.Regexp) *Result {
+	ctx, cancel := withDefaultTimeout(ctx, d.Timeout)
+	defer cancel()
+	// The dns client applies its own Timeout over the context deadline, so
+	// each query gets a client bounded by the deadline of this check.
+	client := &dns.Client{
+		Net:       d.Client.Net,
+		UDPSize:   d.Client.UDPSize,
+		TLSConfig: d.Client.TLSConfig,
+		Timeout:   d.Client.Timeout,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		client.Timeout = time.Until(deadline)
+	}
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, recordType)
+	timeStart := time.Now()
+	resp, _, err := client.ExchangeContext(ctx, msg, nameserver)
+	res := &Result{
+		Timestamp: timeStart,
+		Result:    Success,
+		Duration:  time.Since(timeStart),
+	}
+	if err != nil {
+		log.Debugf("DNSCheck for %s via %s failed: %v", name, nameserver, err)
+		code, category := classifyNetError(err)
+		res.Fail(code, category, "%s", err)
+		return res
+	}
+
+	values := make([]string, 0, len(resp.Answer))
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == recordType {
+			values = append(values, dnsRecordValue(rr))
+		}
+	}
+	if resp.Rcode != dns.RcodeSuccess || len(values) == 0 {
+		log.Debugf("DNSCheck for %s via %s: %s with %d answers", name, nameserver, dns.RcodeToString[resp.Rcode], len(values))
+		res.Fail(Failure, CategoryDNS, "%s %s returned %s with %d answers",
+			dns.TypeToString[recordType], name, dns.RcodeToString[resp.Rcode], len(values))
+	} else if !matchDNSAnswers(values, expected, rex) {
+		log.Debugf("DNSCheck for %s via %s: unexpected answers %v", name, nameserver, values)
+		res.Fail(Failure, CategoryContent, "%s %s returned unexpected answers: %s",
+			dns.TypeToString[recordType], name, strings.Join(values, ", "))
+	}
+	res.SetMetric("rcode", float64(resp.Rcode))
+	res.SetMetric("answers", float64(len(values)))
+	return res
+}
+
+func defaultNameserver() (string, error) {
+	conf, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		return "", err
+	}
+	if len(conf.Servers) == 0 {
+		return "", fmt.Errorf("no nameservers in %s", resolvConfPath)
+	}
+	return net.JoinHostPort(conf.Servers[0], conf.Port), nil
+}
+
+var DNSCheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "name", Required: true, Description: "name to resolve"},
+	{Name: "recordType", Default: "A", Description: "one of A, AAAA, CNAME, MX, TXT"},
+	{Name: "nameserver", Description: "nameserver to query, defaults to the first one in " + resolvConfPath},
+	{Name: "expected", Description: "comma separated set of answers that must be returned"},
+	{Name: "expectRegexp", Type: ArgRegexp, Description: "regexp at least one answer must match"},
+}}
+
+func (d *DNSChecker) NewDNSCheck(args map[string]string) (CheckFunc, error) {
+	name, ok := args["name"]
+	if !ok {
+		return nil, fmt.Errorf("DNSCheck missing 'name' parameter")
+	}
+	typeArg, _ := DNSCheckArgs.Lookup(args, "recordType")
+	recordType, ok := dnsRecordTypes[strings.ToUpper(typeArg)]
+	if !ok {
+		return nil, fmt.Errorf("DNSCheck unsupported 'recordType': %s", typeArg)
+	}
+
+	nameserver, ok := args["nameserver"]
+	if ok {
+		if _, _, err := net.SplitHostPort(nameserver); err != nil {
+			nameserver = net.JoinHostPort(nameserver, defaultDNSPort)
+		}
+	} else {
+		var err error
+		if nameserver, err = defaultNameserver(); err != nil {
+			return nil, fmt.Errorf("DNSCheck couldn't find a default nameserver: %s", err)
+		}
+	}
+
+	var expected []string
+	if expectedArg, ok := args["expected"]; ok {
+		for _, value := range strings.Split(expectedArg, ",") {
+			value = strings.TrimSpace(value)
+			switch recordType {
+			case dns.TypeA, dns.TypeAAAA:
+				if ip := net.ParseIP(value); ip != nil {
+					value = ip.String()
+				}
+			case dns.TypeCNAME, dns.TypeMX:
+				value = normalizeDNSName(value)
+			}
+			expected = append(expected, value)
+		}
+		sort.Strings(expected)
+	}
+	var expectRegexp *regexp.Regexp
+	if expectArg, ok := args["expectRegexp"]; ok {
+		var err error
+		if expectRegexp, err = regexp.Compile(expectArg); err != nil {
+			return nil, fmt.Errorf("DNSCheck 'expectRegexp' is not a valid regexp: %s", err)
+		}
+	}
+
+	fqdn := dns.Fqdn(name)
+	return func(ctx context.Context) *Result {
+		return d.DNSCheck(ctx, nameserver, fqdn, recordType, expected, expectRegexp)
+	}, nil
+}
@@ -0,0 +1,126 @@
+package healthchecker
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var testDNSZone = map[uint16][]string{
+	dns.TypeA:     {"www.example.test. 60 IN A 192.0.2.10", "www.example.test. 60 IN A 192.0.2.11"},
+	dns.TypeAAAA:  {"www.example.test. 60 IN AAAA 2001:db8::10"},
+	dns.TypeCNAME: {"www.example.test. 60 IN CNAME lb.Example.test."},
+	dns.TypeMX:    {"www.example.test. 60 IN MX 10 mail.example.test."},
+	dns.TypeTXT:   {`www.example.test. 60 IN TXT "v=spf1 " "-all"`, `www.example.test. 60 IN TXT "site-verification=abc"`},
+}
+
+func startDNSServer(t *testing.T) *dns.Server {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't start udp listener: %s", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			q := req.Question[0]
+			if q.Name != "www.example.test." {
+				resp.Rcode = dns.RcodeNameError
+			}
+			for _, record := range testDNSZone[q.Qtype] {
+				if q.Name == "www.example.test." {
+					rr, _ := dns.NewRR(record)
+					resp.Answer = append(resp.Answer, rr)
+				}
+			}
+			w.WriteMsg(resp)
+		}),
+	}
+	go server.ActivateAndServe()
+	<-started
+	return server
+}
+
+func TestDNSCheck(t *testing.T) {
+	server := startDNSServer(t)
+	defer server.Shutdown()
+	nameserver := server.PacketConn.LocalAddr().String()
+
+	dnsTests := []struct {
+		name   string
+		args   map[string]string
+		result ResultCode
+	}{
+		{"resolves", map[string]string{"name": "www.example.test"}, Success},
+		{"A set", map[string]string{"name": "www.example.test", "expected": "192.0.2.11, 192.0.2.10"}, Success},
+		{"A set changed", map[string]string{"name": "www.example.test", "expected": "192.0.2.10"}, Failure},
+		{"AAAA", map[string]string{"name": "www.example.test", "recordType": "AAAA", "expected": "2001:0db8::0010"}, Success},
+		{"CNAME", map[string]string{"name": "www.example.test", "recordType": "cname", "expected": "lb.example.test."}, Success},
+		{"MX", map[string]string{"name": "www.example.test", "recordType": "MX", "expected": "10 mail.example.test"}, Success},
+		{"TXT regexp", map[string]string{"name": "www.example.test", "recordType": "TXT", "expectRegexp": "^v=spf1 -all$"}, Success},
+		{"TXT regexp mismatch", map[string]string{"name": "www.example.test", "recordType": "TXT", "expectRegexp": "^google"}, Failure},
+		{"NXDOMAIN", map[string]string{"name": "missing.example.test"}, Failure},
+	}
+
+	checker := NewDNSChecker(time.Second)
+	for _, tt := range dnsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args["nameserver"] = nameserver
+			checkFunc, err := checker.NewDNSCheck(tt.args)
+			if err != nil {
+				t.Fatalf("Couldn't create check: %s", err)
+			}
+			res := checkFunc(context.Background())
+			if res.Result != tt.result {
+				t.Errorf("Got: %s, Wanted: %s", res.Result, tt.result)
+			}
+		})
+	}
+}
+
+func TestDNSCheckTimeout(t *testing.T) {
+	pc, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	defer pc.Close()
+
+	checker := NewDNSChecker(100 * time.Millisecond)
+	checkFunc, _ := checker.NewDNSCheck(map[string]string{
+		"name":       "www.example.test",
+		"nameserver": pc.LocalAddr().String(),
+	})
+	res := checkFunc(context.Background())
+	if res.Result != Failure {
+		t.Errorf("Expected Failure on timeout, got: %s", res.Result)
+	}
+}
+
+func TestNewDNSCheckArgs(t *testing.T) {
+	argTests := []struct {
+		name    string
+		args    map[string]string
+		succeed bool
+	}{
+		{"no name", map[string]string{"nameserver": "127.0.0.1"}, false},
+		{"bad record type", map[string]string{"name": "example.com", "recordType": "SOA", "nameserver": "127.0.0.1"}, false},
+		{"bad regexp", map[string]string{"name": "example.com", "expectRegexp": "(", "nameserver": "127.0.0.1"}, false},
+		{"alright", map[string]string{"name": "example.com", "nameserver": "127.0.0.1"}, true},
+	}
+
+	checker := NewDNSChecker(time.Second)
+	for _, tt := range argTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checker.NewDNSCheck(tt.args)
+			if !tt.succeed && err == nil {
+				t.Errorf("Got %#v, expected to fail but succeeded", tt.args)
+			}
+			if tt.succeed && err != nil {
+				t.Errorf("Got %#v, expected to succeed but failed: %s", tt.args, err)
+			}
+		})
+	}
+}
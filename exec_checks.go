@@ -0,0 +1,333 @@
+package healthchecker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	execEnvPrefix = "env."
+	// Plugins should print a line or two, anything past this is dropped.
+	maxExecOutput = 64 << 10
+	// execWaitDelay is how long to wait for the output of a plugin once it
+	// exited or was killed, in case something it started still holds it
+	// open.
+	execWaitDelay = 100 * time.Millisecond
+	// execPerfdataPrefix is added to perfdata labels so they can't clash
+	// with exit_code or the fields sinks add.
+	execPerfdataPrefix = "perf_"
+)
+
+// Nagios plugin exit codes.
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+)
+
+type ExecChecker struct {
+	Timeout time.Duration
+}
+
+func NewExecChecker(timeout time.Duration) *ExecChecker {
+	return &ExecChecker{Timeout: timeout}
+}
+
+// cappedBuffer keeps the first maxExecOutput bytes written to it.
+type cappedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := maxExecOutput - b.Len(); room < len(p) {
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// copyOutput returns a pipe for a command to write its output to and copies
+// the output into buf. stop waits up to wait for every writer to close the
+// pipe, then closes it and returns once nothing is written to buf anymore.
+func copyOutput(buf io.Writer) (w *os.File, stop func(wait time.Duration), err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(buf, r)
+	}()
+	stop = func(wait time.Duration) {
+		select {
+		case <-done:
+		case <-time.After(wait):
+		}
+		r.Close()
+		<-done
+	}
+	return w, stop, nil
+}
+
+// splitArgs splits a command line into arguments on whitespace, keeping
+// single or double quoted parts together.
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, char := range line {
+		switch {
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(char)
+		case char == '\'' || char == '"':
+			quote, inArg = char, true
+		case char == ' ' || char == '\t' || char == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(char)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// perfdataLabel reads the label at the start of perfdata, which is quoted
+// with single quotes when it contains spaces, doubling quotes inside it.
+func perfdataLabel(perfdata string) (string, string, bool) {
+	if !strings.HasPrefix(perfdata, "'") {
+		end := strings.IndexAny(perfdata, "= \t\n")
+		if end <= 0 || perfdata[end] != '=' {
+			return "", "", false
+		}
+		return perfdata[:end], perfdata[end+1:], true
+	}
+	var label strings.Builder
+	for i := 1; i < len(perfdata); i++ {
+		if perfdata[i] != '\'' {
+			label.WriteByte(perfdata[i])
+			continue
+		}
+		if i+1 < len(perfdata) && perfdata[i+1] == '\'' {
+			label.WriteByte('\'')
+			i++
+			continue
+		}
+		if i+1 < len(perfdata) && perfdata[i+1] == '=' {
+			return label.String(), perfdata[i+2:], true
+		}
+		return "", "", false
+	}
+	return "", "", false
+}
+
+// ParsePerfdata parses Nagios performance data, space separated items like
+// 'label'=value[UOM];[warn];[crit];[min];[max], into metrics. The value is
+// stored under the label as it is, without its unit, and warn, crit, min
+// and max under the label with a _warn, _crit, _min or _max suffix when
+// they are plain numbers rather than ranges. Malformed items and unknown
+// values are skipped.
+func ParsePerfdata(perfdata string) map[string]float64 {
+	metrics := make(map[string]float64)
+	perfdata = strings.TrimSpace(perfdata)
+	for perfdata != "" {
+		label, rest, ok := perfdataLabel(perfdata)
+		if !ok {
+			rest = perfdata
+		}
+		end := strings.IndexAny(rest, " \t\n")
+		if end < 0 {
+			end = len(rest)
+		}
+		item := rest[:end]
+		perfdata = strings.TrimSpace(rest[end:])
+		if !ok {
+			log.Debugf("Skipping malformed perfdata: %s", item)
+			continue
+		}
+
+		fields := strings.Split(item, ";")
+		value := strings.TrimRight(fields[0], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ%")
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Debugf("Skipping perfdata %s: %s", label, fields[0])
+			continue
+		}
+		metrics[label] = parsed
+		for i, suffix := range []string{"_warn", "_crit", "_min", "_max"} {
+			if i+1 >= len(fields) {
+				break
+			}
+			if threshold, err := strconv.ParseFloat(fields[i+1], 64); err == nil {
+				metrics[label+suffix] = threshold
+			}
+		}
+	}
+	return metrics
+}
+
+// parsePluginOutput splits the output of a Nagios plugin into the text of
+// its first line and its perfdata, which follows a '|' on the first line
+// and, for plugins printing more lines, a '|' anywhere after it.
+func parsePluginOutput(output string) (string, string) {
+	lines := strings.SplitN(strings.TrimSpace(output), "\n", 2)
+	text, perfdata := lines[0], ""
+	if i := strings.IndexByte(text, '|'); i >= 0 {
+		text, perfdata = text[:i], text[i+1:]
+	}
+	if len(lines) > 1 {
+		if i := strings.IndexByte(lines[1], '|'); i >= 0 {
+			perfdata += " " + lines[1][i+1:]
+		}
+	}
+	return strings.TrimSpace(text), perfdata
+}
+
+// ExecCheck runs command with args and env added to the environment, the
+// way Nagios runs its plugins. Exit code 0 is a Success, 1 and 2, a warning
+// and a critical problem, are a Failure and 3, unknown, or anything else is
+// an Error. The first line of output is the message and its perfdata become
+// metrics prefixed with perf_.
+func (e *ExecChecker) ExecCheck(ctx context.Context, command string, args []string, env []string) *Result {
+	ctx, cancel := withDefaultTimeout(ctx, e.Timeout)
+	defer cancel()
+	timeStart := time.Now()
+	timeout := contextDeadline(ctx).Sub(timeStart).Round(time.Millisecond)
+	res := &Result{Timestamp: timeStart, Result: Success}
+	fail := func(err error) *Result {
+		log.Debugf("ExecCheck couldn't run %s: %s", command, err)
+		res.Duration = time.Since(timeStart)
+		res.Fail(Error, CategoryNone, "couldn't run %s: %s", command, err)
+		return res
+	}
+
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	// The output is read from pipes of our own, so a process the plugin
+	// started that keeps them open can't hold up the check.
+	var stdout, stderr cappedBuffer
+	stdoutPipe, stopStdout, err := copyOutput(&stdout)
+	if err != nil {
+		return fail(err)
+	}
+	stderrPipe, stopStderr, err := copyOutput(&stderr)
+	if err != nil {
+		stdoutPipe.Close()
+		stopStdout(0)
+		return fail(err)
+	}
+	cmd.Stdout, cmd.Stderr = stdoutPipe, stderrPipe
+	// Plugins are often shell or Perl wrappers, so the processes they start
+	// are killed with them.
+	setProcessGroup(cmd)
+	err = cmd.Start()
+	stdoutPipe.Close()
+	stderrPipe.Close()
+	if err != nil {
+		stopStdout(0)
+		stopStderr(0)
+		return fail(err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- cmd.Wait()
+	}()
+	select {
+	case err = <-waited:
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		err = <-waited
+	}
+	stopStdout(execWaitDelay)
+	stopStderr(execWaitDelay)
+	res.Duration = time.Since(timeStart)
+	if ctx.Err() == context.DeadlineExceeded {
+		res.Fail(Error, CategoryTimeout, "%s did not finish within %s", command, timeout)
+		return res
+	}
+	exitCode := 0
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return fail(err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	output := stdout.String()
+	if strings.TrimSpace(output) == "" {
+		output = stderr.String()
+	}
+	message, perfdata := parsePluginOutput(output)
+	for metric, value := range ParsePerfdata(perfdata) {
+		res.SetMetric(execPerfdataPrefix+metric, value)
+	}
+	res.SetMetric("exit_code", float64(exitCode))
+	if message == "" && exitCode != nagiosOK {
+		message = fmt.Sprintf("%s exited with %d", command, exitCode)
+	}
+	switch exitCode {
+	case nagiosOK:
+		res.Message = message
+	case nagiosWarning, nagiosCritical:
+		res.Fail(Failure, CategoryStatus, "%s", message)
+	default:
+		res.Fail(Error, CategoryNone, "%s", message)
+	}
+	log.Debugf("ExecCheck %s exited with %d: %s", command, exitCode, message)
+	return res
+}
+
+var ExecCheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "command", Required: true, Description: "path of the command to run, or its name to look up in PATH"},
+	{Name: "args", Description: "arguments of the command, split on spaces unless quoted"},
+	{Name: execEnvPrefix + "*", Description: "environment variable of the command, eg. env.LC_ALL"},
+}}
+
+func (e *ExecChecker) NewExecCheck(args map[string]string) (CheckFunc, error) {
+	command, ok := args["command"]
+	if !ok {
+		return nil, fmt.Errorf("ExecCheck missing 'command' parameter")
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("ExecCheck cannot run 'command': %s", err)
+	}
+	commandArgs, err := splitArgs(args["args"])
+	if err != nil {
+		return nil, fmt.Errorf("ExecCheck invalid 'args': %s", err)
+	}
+	env := make([]string, 0)
+	for arg, value := range args {
+		if strings.HasPrefix(arg, execEnvPrefix) {
+			env = append(env, strings.TrimPrefix(arg, execEnvPrefix)+"="+value)
+		}
+	}
+	return func(ctx context.Context) *Result {
+		return e.ExecCheck(ctx, command, commandArgs, env)
+	}, nil
+}
@@ -0,0 +1,144 @@
+package healthchecker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePerfdata(t *testing.T) {
+	perfdataTests := []struct {
+		name     string
+		perfdata string
+		metrics  map[string]float64
+	}{
+		{"value only", "time=0.5s", map[string]float64{"time": 0.5}},
+		{"thresholds", "load1=0.7;5;10;0", map[string]float64{"load1": 0.7, "load1_warn": 5, "load1_crit": 10, "load1_min": 0}},
+		{"ranges", "users=3;@1:5;~:10;;", map[string]float64{"users": 3}},
+		{"quoted", "'disk /var'=80%;90;95;0;100 'it''s'=1c", map[string]float64{
+			"disk /var": 80, "disk /var_warn": 90, "disk /var_crit": 95, "disk /var_min": 0, "disk /var_max": 100, "it's": 1,
+		}},
+		{"several", "rta=0.1ms;100;500 pl=0%;20;60", map[string]float64{
+			"rta": 0.1, "rta_warn": 100, "rta_crit": 500, "pl": 0, "pl_warn": 20, "pl_crit": 60,
+		}},
+		{"malformed", "broken 'unclosed=1 size=U ok=2", map[string]float64{"ok": 2}},
+		{"empty", "  ", map[string]float64{}},
+	}
+
+	for _, tt := range perfdataTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if metrics := ParsePerfdata(tt.perfdata); !reflect.DeepEqual(metrics, tt.metrics) {
+				t.Errorf("Expected %v, got %v", tt.metrics, metrics)
+			}
+		})
+	}
+}
+
+func TestParsePluginOutput(t *testing.T) {
+	text, perfdata := parsePluginOutput("DISK OK - free space: / 3326 MB | /=2643MB;5948;5958;0;5968\n/ 15272 MB (77%);\n/boot 68 MB (69%); | /boot=68MB;88;93;0;98\n")
+	if text != "DISK OK - free space: / 3326 MB" {
+		t.Errorf("Unexpected text: %q", text)
+	}
+	metrics := ParsePerfdata(perfdata)
+	if metrics["/"] != 2643 || metrics["/boot"] != 68 {
+		t.Errorf("Expected perfdata from the first and following lines, got: %v", metrics)
+	}
+}
+
+func TestExecCheck(t *testing.T) {
+	checker := NewExecChecker(5 * time.Second)
+	execTests := []struct {
+		name     string
+		script   string
+		result   ResultCode
+		category ErrorCategory
+		message  string
+	}{
+		{"ok", "echo 'PING OK - rta 0.1ms | rta=0.1ms;100;500'", Success, CategoryNone, "PING OK - rta 0.1ms"},
+		{"warning", "echo 'LOAD WARNING'; exit 1", Failure, CategoryStatus, "LOAD WARNING"},
+		{"critical", "echo 'DISK CRITICAL'; echo 'details'; exit 2", Failure, CategoryStatus, "DISK CRITICAL"},
+		{"unknown", "echo 'UNKNOWN - bad args' >&2; exit 3", Error, CategoryNone, "UNKNOWN - bad args"},
+		{"other", "exit 7", Error, CategoryNone, "sh exited with 7"},
+		{"silent critical", "exit 2", Failure, CategoryStatus, "sh exited with 2"},
+		{"env", "echo \"$CHECK_TARGET\"", Success, CategoryNone, "db.example.com"},
+	}
+
+	for _, tt := range execTests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := checker.ExecCheck(context.Background(), "sh", []string{"-c", tt.script}, []string{"CHECK_TARGET=db.example.com"})
+			if res.Result != tt.result || res.Category != tt.category || res.Message != tt.message {
+				t.Errorf("Expected %s [%s] %q, got %s [%s] %q", tt.result, tt.category, tt.message, res.Result, res.Category, res.Message)
+			}
+		})
+	}
+
+	res := checker.ExecCheck(context.Background(), "sh", []string{"-c", "echo 'OK | rta=0.1ms;100;500 exit_code=5'"}, nil)
+	if res.Metrics["perf_rta"] != 0.1 || res.Metrics["perf_rta_crit"] != 500 || res.Metrics["exit_code"] != 0 || res.Metrics["perf_exit_code"] != 5 {
+		t.Errorf("Expected prefixed perfdata metrics, got: %v", res.Metrics)
+	}
+
+	timeoutTests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{"command", "sleep", []string{"5"}},
+		{"child process", "sh", []string{"-c", "sleep 5; echo OK"}},
+	}
+	for _, tt := range timeoutTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			timeStart := time.Now()
+			res := checker.ExecCheck(ctx, tt.command, tt.args, nil)
+			if res.Result != Error || res.Category != CategoryTimeout || res.Message != tt.command+" did not finish within 100ms" {
+				t.Errorf("Expected a timeout, got %s [%s] %s", res.Result, res.Category, res.Message)
+			}
+			if elapsed := time.Since(timeStart); elapsed > time.Second {
+				t.Errorf("Expected the check to stop at its timeout, took %s", elapsed)
+			}
+		})
+	}
+
+	// A process left behind in a session of its own keeps the output open.
+	timeStart := time.Now()
+	res = checker.ExecCheck(context.Background(), "sh", []string{"-c", "setsid sleep 5 & echo OK"}, nil)
+	if res.Result != Success || res.Message != "OK" {
+		t.Errorf("Expected the output of the plugin, got %s: %s", res.Result, res.Message)
+	}
+	if elapsed := time.Since(timeStart); elapsed > time.Second {
+		t.Errorf("Expected the check not to wait for the detached process, took %s", elapsed)
+	}
+}
+
+func TestNewExecCheckArgs(t *testing.T) {
+	checker := NewExecChecker(time.Second)
+	argsTests := []struct {
+		name    string
+		args    map[string]string
+		succeed bool
+	}{
+		{"command only", map[string]string{"command": "true"}, true},
+		{"args and env", map[string]string{"command": "sh", "args": "-c 'exit 0'", "env.LC_ALL": "C"}, true},
+		{"missing command", map[string]string{}, false},
+		{"unknown command", map[string]string{"command": "/nonexistent/check_nothing"}, false},
+		{"unterminated quote", map[string]string{"command": "sh", "args": "-c 'exit 0"}, false},
+	}
+
+	for _, tt := range argsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checker.NewExecCheck(tt.args)
+			if tt.succeed && err != nil {
+				t.Errorf("Expected %v to succeed, got: %s", tt.args, err)
+			} else if !tt.succeed && err == nil {
+				t.Errorf("Expected %v to fail", tt.args)
+			}
+		})
+	}
+
+	check, _ := checker.NewExecCheck(map[string]string{"command": "sh", "args": `-c 'echo "$GREETING world"'`, "env.GREETING": "hello"})
+	if res := check(context.Background()); res.Message != "hello world" {
+		t.Errorf("Expected args and env to reach the command, got: %q", res.Message)
+	}
+}
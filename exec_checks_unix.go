@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package healthchecker
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd run in its own process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the started cmd and every process in its group.
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,12 @@
+package healthchecker
+
+import "os/exec"
+
+// setProcessGroup leaves cmd as it is, only the command itself is killed
+// when it times out.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the started cmd.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -1,7 +1,10 @@
 package healthchecker
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"reflect"
 	"sync"
 	"time"
 
@@ -14,6 +17,9 @@ const (
 	Success ResultCode = 0
 	Failure ResultCode = 1
 	Error   ResultCode = 2
+	// UpstreamDown replaces the failure of a check while a check it depends
+	// on is down. It doesn't change the state of the check.
+	UpstreamDown ResultCode = 3
 )
 
 func (o ResultCode) String() string {
@@ -22,51 +28,297 @@ func (o ResultCode) String() string {
 		return "Success"
 	case 1:
 		return "Failure"
+	case 3:
+		return "UpstreamDown"
 	default:
 		return "Error"
 	}
 }
 
+type ErrorCategory string
+
+const (
+	CategoryNone       ErrorCategory = ""
+	CategoryTimeout    ErrorCategory = "timeout"
+	CategoryConnection ErrorCategory = "connection"
+	CategoryDNS        ErrorCategory = "dns"
+	CategoryTLS        ErrorCategory = "tls"
+	CategoryStatus     ErrorCategory = "status"
+	CategoryContent    ErrorCategory = "content"
+	CategoryProtocol   ErrorCategory = "protocol"
+	CategoryExpiry     ErrorCategory = "expiry"
+	CategorySLO        ErrorCategory = "slo"
+)
+
 type Result struct {
 	Timestamp time.Time
 	Result    ResultCode
 	Duration  time.Duration
+	Message   string
+	Category  ErrorCategory
+	Metrics   map[string]float64
+	// Attempts is how many times the check ran to produce the result, more
+	// than 1 when it was retried.
+	Attempts int
+	// Maintenance is set on results of checks in maintenance, which
+	// notification sinks don't notify about.
+	Maintenance bool
 }
 
 func (c *Result) TimestampString() string {
-	return fmt.Sprintf(c.Timestamp.Format("2006-01-02 15:04:05.999999"))
+	return c.Timestamp.Format("2006-01-02 15:04:05.999999")
+}
+
+// Fail sets the outcome of the result along with the reason it wasn't a Success.
+func (c *Result) Fail(code ResultCode, category ErrorCategory, format string, args ...interface{}) {
+	c.Result = code
+	c.Category = category
+	c.Message = fmt.Sprintf(format, args...)
+}
+
+// notify reports whether notification sinks should send the result, they
+// don't for checks in maintenance or behind a check that's down.
+func (c *Result) notify() bool {
+	return !c.Maintenance && c.Result != UpstreamDown
+}
+
+func (c *Result) SetMetric(name string, value float64) {
+	if c.Metrics == nil {
+		c.Metrics = make(map[string]float64)
+	}
+	c.Metrics[name] = value
 }
 
+const (
+	defaultShutdownTimeout = 10 * time.Second
+	hardDeadlineGrace      = time.Second
+	// How far back history is read to restore the state of a new check.
+	stateRestoreWindow = 7 * hoursInDay * time.Hour
+)
+
+type CheckFunc func(ctx context.Context) *Result
+
 type HealthCheck struct {
-	fn       func() *Result
+	fn       CheckFunc
 	sinks    []Emitter
 	Interval time.Duration
+	Timeout  time.Duration
 	Name     string
 	Type     string
+	// Schedule decides when the check runs. Interval is the time between
+	// runs, for checks not on an interval an estimate of it.
+	Schedule Schedule
+	// Retries is how many times a failed check is run again within the same
+	// interval before its result is emitted, waiting RetryDelay before the
+	// first retry and twice as long before each following one.
+	Retries    int
+	RetryDelay time.Duration
+	// Splay decides when the check first runs and Jitter is the most every
+	// run is randomly delayed by, see scheduling.go.
+	Splay  SplayMode
+	Jitter time.Duration
+	// Critical checks make the status API report the service as unhealthy
+	// while they are down.
+	Critical bool
+	// Component groups checks on the status page.
+	Component string
+	// Tags select checks for maintenance.
+	Tags []string
+	// DependsOn names the checks this one needs to succeed, OnUpstreamDown
+	// decides what happens to it while any of them is down.
+	DependsOn      []string
+	OnUpstreamDown UpstreamMode
+	state          *stateTracker
+	history        History
+	maintenance    *Maintenance
+	deps           *dependencies
+	// combines holds the names of the checks whose results the check
+	// combines, eg. in a CompositeCheck.
+	combines []string
+	// conf is the config the check was created from, nil for checks added
+	// with AddCheck. sinkDeps holds every sink the check's sinks depend on,
+	// privateSinks the ones created for the check alone.
+	conf         *HealthChecksConfig
+	sinkDeps     []Emitter
+	privateSinks []privateSink
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+// hardDeadline is how long the scheduler waits for the check function before
+// giving up on it, regardless of whether it honours its context.
+func (h *HealthCheck) hardDeadline() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout + hardDeadlineGrace
+	}
+	return h.Interval
+}
+
+func (h *HealthCheck) execute(ctx context.Context) *Result {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	deadline := h.hardDeadline()
+	if deadline <= 0 {
+		return h.fn(ctx)
+	}
+
+	// fn gets a context of its own, cancelled when it is given up on so
+	// that checks honouring it don't keep running in the background.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timeStart := time.Now()
+	results := make(chan *Result, 1)
+	go func() {
+		results <- h.fn(ctx)
+	}()
+	select {
+	case res := <-results:
+		return res
+	case <-time.After(deadline):
+		log.Errorf("Check %s did not return within %s", h.Name, deadline)
+		res := &Result{
+			Timestamp: timeStart,
+			Duration:  time.Since(timeStart),
+		}
+		res.Fail(Error, CategoryTimeout, "check did not return within %s", deadline)
+		return res
+	}
+}
+
+// Check runs the check once and returns its result without updating the
+// check's state or emitting the result.
+func (h *HealthCheck) Check(ctx context.Context) *Result {
+	res := h.execute(ctx)
+	if res == nil {
+		res = &Result{Timestamp: time.Now()}
+		res.Fail(Error, CategoryNone, "check returned no result")
+	}
+	res.Attempts = 1
+	return res
+}
+
+// checkWithRetries runs the check until it succeeds, it was retried Retries
+// times or the next retry wouldn't start within the check's interval.
+func (h *HealthCheck) checkWithRetries(ctx context.Context) *Result {
+	deadline := time.Now().Add(h.Interval)
+	delay := h.RetryDelay
+	res := h.Check(ctx)
+	for attempt := 2; attempt <= h.Retries+1 && res.Result != Success; attempt++ {
+		if h.Interval > 0 && time.Now().Add(delay).After(deadline) {
+			log.Debugf("Not retrying %s, next attempt wouldn't start within its interval", h.Name)
+			break
+		}
+		log.Debugf("Retrying %s in %s after %s: %s", h.Name, delay, res.Result, res.Message)
+		select {
+		case <-ctx.Done():
+			return res
+		case <-time.After(delay):
+		}
+		res = h.Check(ctx)
+		res.Attempts = attempt
+		delay *= 2
+	}
+	return res
+}
+
+// InMaintenance returns why the check is in maintenance at t, if it is.
+func (h *HealthCheck) InMaintenance(t time.Time) (string, bool) {
+	if h.maintenance == nil {
+		return "", false
+	}
+	return h.maintenance.Reason(h, t)
 }
 
 // TODO get rid of duplicate names eg. CheckResult -> Result
-func (h *HealthCheck) Run() {
-	res := h.fn()
+func (h *HealthCheck) Run(ctx context.Context) {
+	if h.OnUpstreamDown == UpstreamSkip {
+		if upstream, down := h.DownDependency(); down {
+			log.Debugf("Skipping %s, %s is down", h.Name, upstream)
+			return
+		}
+	}
+	res := h.checkWithRetries(ctx)
+	if ctx.Err() == context.Canceled {
+		log.Debugf("Dropping result of %s, check was cancelled", h.Name)
+		return
+	}
+	if res.Result != Success {
+		if upstream, down := h.DownDependency(); down {
+			res.Fail(UpstreamDown, res.Category, "%s is down: %s", upstream, res.Message)
+		}
+	}
+	if reason, ok := h.InMaintenance(res.Timestamp); ok {
+		log.Debugf("Check %s is in %s", h.Name, reason)
+		res.Maintenance = true
+	}
+	state := h.state.update(res)
+	if state.Changed {
+		log.Infof("Check %s is now %s (was %s)", h.Name, state.Status, state.Previous)
+	}
+	if h.history != nil {
+		if err := h.history.Record(h.Name, NewHistoryEntry(res, &state)); err != nil {
+			log.Errorf("Error recording history of %s: %s", h.Name, err)
+		}
+	}
 	for _, s := range h.sinks {
 		log.Debugf("Emitting %s result (%s) to %v", h.Name, res.Result, s.Name())
-		s.Emit(h.Name, h.Type, res)
+		s.Emit(h.Name, h.Type, res, &state)
 	}
 }
 
+func (h *HealthCheck) State() CheckState {
+	return h.state.current()
+}
+
+// LastResult is the latest result the check emitted, nil before its first run.
+func (h *HealthCheck) LastResult() *Result {
+	return h.state.lastResult()
+}
+
 func (h *HealthCheck) String() string {
 	return fmt.Sprintf("(%s: %s)", h.Type, h.Name)
 }
 
-type HealthCheckConstructor func(map[string]string) (func() *Result, error)
+type HealthCheckConstructor func(map[string]string) (CheckFunc, error)
 type SinkConstructor func(map[string]string) (Emitter, error)
 
 type Registry struct {
 	CheckConstructors map[string]HealthCheckConstructor
 	SinkConstructors  map[string]SinkConstructor
-	Checks            []*HealthCheck
-	Sinks             map[string]Emitter
-	running           bool
+	CheckSchemas      map[string]ArgSchema
+	SinkSchemas       map[string]ArgSchema
+	// SkipInvalidChecks makes RegisterHealthChecks log and skip invalid
+	// checks instead of failing.
+	SkipInvalidChecks bool
+	// SkipSinks makes checks created from a config go without sinks, their
+	// args are only validated against SinkSchemas. It's meant for checking a
+	// config next to a running healthchecker, whose sinks may hold on to
+	// ports or files.
+	SkipSinks bool
+	// Splay and Jitter are used by checks that don't set their own.
+	Splay  SplayMode
+	Jitter time.Duration
+	// Maintenance decides when checks are in maintenance, its windows are
+	// set from the config.
+	Maintenance *Maintenance
+	deps        *dependencies
+	// History, if set, records the results of every check created after it
+	// was set.
+	History         History
+	Checks          []*HealthCheck
+	Sinks           map[string]Emitter
+	ShutdownTimeout time.Duration
+	createdSinks    []Emitter
+	acquiredSinks   []Emitter
+	builtSinks      []privateSink
+	reusableSinks   []privateSink
+	reloadMu        sync.Mutex
+	mu              sync.Mutex
+	runCtx          context.Context
+	cancel          context.CancelFunc
 }
 
 func NewRegistry() *Registry {
@@ -74,13 +326,29 @@ func NewRegistry() *Registry {
 	registry := Registry{}
 	registry.CheckConstructors = make(map[string]HealthCheckConstructor)
 	registry.SinkConstructors = make(map[string]SinkConstructor)
+	registry.CheckSchemas = make(map[string]ArgSchema)
+	registry.SinkSchemas = make(map[string]ArgSchema)
 	registry.Checks = make([]*HealthCheck, 0)
 	registry.Sinks = make(map[string]Emitter)
-	registry.running = false
+	registry.ShutdownTimeout = defaultShutdownTimeout
+	registry.Maintenance = NewMaintenance()
+	registry.deps = newDependencies()
 	return &registry
 }
 
-func (c *Registry) AddCheck(checkName string, checkType string, checkArgs map[string]string, interval int, sinks []Emitter) (*HealthCheck, error) {
+// RegisterCheckType makes a check type available to configs.
+func (c *Registry) RegisterCheckType(checkType string, constructor HealthCheckConstructor, schema ArgSchema) {
+	c.CheckConstructors[checkType] = constructor
+	c.CheckSchemas[checkType] = schema
+}
+
+// RegisterSinkType makes a sink type available to configs.
+func (c *Registry) RegisterSinkType(sinkType string, constructor SinkConstructor, schema ArgSchema) {
+	c.SinkConstructors[sinkType] = constructor
+	c.SinkSchemas[sinkType] = schema
+}
+
+func (c *Registry) newCheck(checkName string, checkType string, checkArgs map[string]string, interval int, sinks []Emitter) (*HealthCheck, error) {
 	log.Infof("Creating new health check: %s (%s) (%v)", checkType, checkName, checkArgs)
 	checkConstructor, ok := c.CheckConstructors[checkType]
 	if !ok {
@@ -92,38 +360,151 @@ func (c *Registry) AddCheck(checkName string, checkType string, checkArgs map[st
 	}
 
 	hc := HealthCheck{
-		fn:       checkFn,
-		sinks:    sinks,
-		Interval: time.Duration(interval) * time.Second,
-		Name:     checkName,
-		Type:     checkType,
+		fn:          checkFn,
+		sinks:       sinks,
+		Interval:    time.Duration(interval) * time.Second,
+		Schedule:    IntervalSchedule{Interval: time.Duration(interval) * time.Second},
+		Name:        checkName,
+		Type:        checkType,
+		state:       newStateTracker(),
+		history:     c.History,
+		maintenance: c.Maintenance,
+		deps:        c.deps,
+	}
+	for _, ref := range c.CheckSchemas[checkType].checkRefs(checkArgs) {
+		hc.combines = append(hc.combines, ref.check)
+	}
+	if c.History != nil {
+		entries, err := c.History.Entries(checkName, time.Now().Add(-stateRestoreWindow), time.Time{})
+		if err != nil {
+			log.Errorf("Couldn't restore state of %s from history: %s", checkName, err)
+		} else if len(entries) > 0 {
+			hc.state.restore(entries)
+			log.Infof("Restored %s as %s from history", checkName, hc.state.current().Status)
+		}
 	}
-	c.Checks = append(c.Checks, &hc)
 	return &hc, nil
 }
 
-func (c *Registry) RegisterHealthChecks(conf *Config) {
-	for _, hc := range conf.HealthChecks {
-		log.Debugf("Creating sinks for %s", hc.Name)
-		sinks, err := c.setupSinks(hc.Name, hc.Sinks)
-		if err != nil {
-			log.Errorf("Could not register %s due to: %s", hc.Name, err)
+func (c *Registry) AddCheck(checkName string, checkType string, checkArgs map[string]string, interval int, sinks []Emitter) (*HealthCheck, error) {
+	hc, err := c.newCheck(checkName, checkType, checkArgs, interval, sinks)
+	if err != nil {
+		return nil, err
+	}
+	c.Checks = append(c.Checks, hc)
+	c.deps.set(c.Checks)
+	return hc, nil
+}
+
+// checkFromConfig creates the sinks and the check described by conf without
+// adding it to the registry.
+func (c *Registry) checkFromConfig(conf HealthChecksConfig) (*HealthCheck, error) {
+	schedule, err := ScheduleFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	c.acquiredSinks, c.builtSinks = nil, nil
+	var sinks []Emitter
+	if !c.SkipSinks {
+		log.Debugf("Creating sinks for %s", conf.Name)
+		if sinks, err = c.setupSinks(conf.Name, conf.Sinks); err != nil {
+			return nil, err
+		}
+	}
+	chk, err := c.newCheck(conf.Name, conf.Type, conf.Args, conf.Interval, sinks)
+	if err != nil {
+		return nil, err
+	}
+	configureCheck(chk, conf)
+	chk.Schedule = schedule
+	chk.Interval = ScheduleInterval(schedule, time.Now())
+	if conf.Splay == "" {
+		chk.Splay = c.Splay
+	}
+	if conf.Jitter == 0 {
+		chk.Jitter = c.Jitter
+	}
+	chk.conf = &conf
+	chk.sinkDeps = c.acquiredSinks
+	chk.privateSinks = c.builtSinks
+	c.acquiredSinks, c.builtSinks = nil, nil
+	return chk, nil
+}
+
+// RegisterHealthChecks validates conf and creates its checks. Unless
+// SkipInvalidChecks is set, nothing is registered if any check is invalid and
+// a *ConfigError listing every problem is returned.
+func (c *Registry) RegisterHealthChecks(conf *Config) error {
+	if !c.SkipInvalidChecks {
+		if err := c.ValidateConfig(conf); err != nil {
+			return err
+		}
+	}
+	configProblems := c.configProblems(conf)
+	c.Maintenance.SetWindows(conf.Maintenance)
+
+	createdMark, checksMark := len(c.createdSinks), len(c.Checks)
+	problems := make([]string, 0)
+	for i, hc := range conf.HealthChecks {
+		if len(configProblems[i]) > 0 {
+			for _, problem := range configProblems[i] {
+				log.Errorf("Skipping invalid check, %s", problem)
+			}
 			continue
 		}
-		_, err = c.AddCheck(hc.Name, hc.Type, hc.Args, hc.Interval, sinks)
+		chk, err := c.checkFromConfig(hc)
 		if err != nil {
-			log.Errorf("Could not register %s due to: %s", hc.Name, err)
+			problem := fmt.Sprintf("%s: %s", checkLocation(hc), err)
+			if c.SkipInvalidChecks {
+				log.Errorf("Skipping invalid check, %s", problem)
+				continue
+			}
+			problems = append(problems, problem)
+			continue
 		}
+		c.Checks = append(c.Checks, chk)
+	}
+	if len(problems) > 0 {
+		c.discardSinks(createdMark)
+		c.Checks = c.Checks[:checksMark]
+		return &ConfigError{Problems: problems}
 	}
+	c.deps.set(c.Checks)
+	return nil
+}
+
+// configureCheck applies the per-check scheduling options from conf.
+func configureCheck(chk *HealthCheck, conf HealthChecksConfig) {
+	chk.Timeout = time.Duration(conf.Timeout) * time.Second
+	chk.Retries = conf.Retries
+	chk.RetryDelay = time.Duration(conf.RetryDelay) * time.Millisecond
+	chk.Splay, _ = ParseSplayMode(conf.Splay)
+	chk.Jitter = time.Duration(conf.Jitter) * time.Millisecond
+	chk.Critical = conf.Critical
+	chk.Component = conf.Component
+	chk.Tags = conf.Tags
+	chk.DependsOn = conf.DependsOn
+	chk.OnUpstreamDown, _ = ParseUpstreamMode(conf.OnUpstreamDown)
+	chk.state.setThresholds(conf.FailuresBeforeDown, conf.SuccessesBeforeUp)
 }
 
 func (c *Registry) getOrCreateSink(checkName, sinkName string, sinkArgs map[string]string) (Emitter, error) {
 	sinkId, sinkIdExists := sinkArgs["id"]
 	if sinkIdExists {
-		delete(sinkArgs, "id")
 		if sink, ok := c.Sinks[sinkId]; ok {
+			c.acquiredSinks = append(c.acquiredSinks, sink)
 			return sink, nil
 		}
+		// Copy the args so the config stays comparable on reload.
+		args := make(map[string]string, len(sinkArgs))
+		for arg, value := range sinkArgs {
+			if arg != "id" {
+				args[arg] = value
+			}
+		}
+		sinkArgs = args
+	} else if sink, ok := c.reuseSink(sinkName, sinkArgs); ok {
+		return sink, nil
 	}
 
 	sinkConstructor, ok := c.SinkConstructors[sinkName]
@@ -131,16 +512,62 @@ func (c *Registry) getOrCreateSink(checkName, sinkName string, sinkArgs map[stri
 		return nil, fmt.Errorf("Unable to create sink '%s': unknown sink type", sinkName)
 	}
 
+	acquiredMark, builtMark := len(c.acquiredSinks), len(c.builtSinks)
 	newSink, err := sinkConstructor(sinkArgs)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to create sink '%s' with args: %v because: %s", sinkName, sinkArgs, err)
 	}
+	c.createdSinks = append(c.createdSinks, newSink)
+	c.acquiredSinks = append(c.acquiredSinks, newSink)
 	if sinkIdExists {
 		c.Sinks[sinkId] = newSink
+	} else {
+		c.builtSinks = append(c.builtSinks, privateSink{
+			sinkType: sinkName,
+			args:     sinkArgs,
+			sink:     newSink,
+			deps:     append([]Emitter(nil), c.acquiredSinks[acquiredMark:]...),
+			wrapped:  append([]privateSink(nil), c.builtSinks[builtMark:]...),
+		})
 	}
 	return newSink, nil
 }
 
+// privateSink is a sink created for a single check, with the sinks it
+// depends on and the private sinks it wraps.
+type privateSink struct {
+	sinkType string
+	args     map[string]string
+	sink     Emitter
+	deps     []Emitter
+	wrapped  []privateSink
+}
+
+// reuseSink returns a private sink of the check being replaced by a reload
+// that was created with the same type and args. Sinks holding on to
+// resources, like a listening port, couldn't be created again while the
+// replaced check still has them.
+func (c *Registry) reuseSink(sinkType string, args map[string]string) (Emitter, bool) {
+	for i, old := range c.reusableSinks {
+		if old.sinkType != sinkType || !reflect.DeepEqual(old.args, args) {
+			continue
+		}
+		c.reusableSinks = append(c.reusableSinks[:i:i], c.reusableSinks[i+1:]...)
+		for _, wrapped := range old.wrapped {
+			for j, reusable := range c.reusableSinks {
+				if reusable.sink == wrapped.sink {
+					c.reusableSinks = append(c.reusableSinks[:j:j], c.reusableSinks[j+1:]...)
+					break
+				}
+			}
+		}
+		c.builtSinks = append(append(c.builtSinks, old.wrapped...), old)
+		c.acquiredSinks = append(c.acquiredSinks, old.deps...)
+		return old.sink, true
+	}
+	return nil, false
+}
+
 func (c *Registry) setupSinks(checkName string, sinkConfigs []map[string]map[string]string) ([]Emitter, error) {
 	sinks := make([]Emitter, 0)
 	for _, sinkConfig := range sinkConfigs {
@@ -155,32 +582,306 @@ func (c *Registry) setupSinks(checkName string, sinkConfigs []map[string]map[str
 	return sinks, nil
 }
 
-func (c *Registry) StartRunning() {
+// StartRunning runs all checks until ctx is cancelled or StopRunning is
+// called. It then waits up to ShutdownTimeout for in-flight checks to return,
+// closes all sinks and returns.
+func (c *Registry) StartRunning(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.mu.Lock()
 	log.Infof("Starting: %d health checks", len(c.Checks))
 	log.Debugf("Health checks: %s", c.Checks)
-	c.running = true
-	var wg sync.WaitGroup
-	for i, _ := range c.Checks {
-		wg.Add(1)
-		go func(chk *HealthCheck) {
-			defer wg.Done()
-			log.Infof("Running check: %s", chk.Name)
-			chk.Run()
-			for range time.Tick(chk.Interval) {
-				if !c.running {
-					log.Infof("Stopping check: %s", chk.Name)
-					return
+	c.cancel = cancel
+	c.runCtx = ctx
+	for _, chk := range c.Checks {
+		c.startCheck(chk)
+	}
+	c.mu.Unlock()
+
+	<-ctx.Done()
+	log.Info("Waiting for in-flight health checks")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runCtx = nil
+	c.stopChecks(c.Checks)
+	c.closeSinks(c.createdSinks)
+	c.createdSinks = nil
+	if closer, ok := c.History.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Errorf("Error closing history: %s", err)
+		}
+	}
+}
+
+func (c *Registry) startCheck(chk *HealthCheck) {
+	ctx, cancel := context.WithCancel(c.runCtx)
+	chk.cancel = cancel
+	chk.done = make(chan struct{})
+	go func() {
+		defer close(chk.done)
+		c.runCheckLoop(ctx, chk)
+	}()
+}
+
+// stopChecks cancels checks and waits up to ShutdownTimeout for them to
+// return.
+func (c *Registry) stopChecks(checks []*HealthCheck) {
+	for _, chk := range checks {
+		if chk.cancel != nil {
+			chk.cancel()
+		}
+	}
+	deadline := time.After(c.ShutdownTimeout)
+	for _, chk := range checks {
+		if chk.done == nil {
+			continue
+		}
+		select {
+		case <-chk.done:
+		case <-deadline:
+			log.Errorf("Health checks did not stop within %s", c.ShutdownTimeout)
+			return
+		}
+	}
+}
+
+func (c *Registry) runCheckLoop(ctx context.Context, chk *HealthCheck) {
+	next := chk.firstRun(time.Now())
+	for !next.IsZero() {
+		log.Debugf("Next run of %s at %s", chk.Name, next)
+		if !sleep(ctx, time.Until(next)+chk.jitter()) {
+			log.Infof("Stopping check: %s", chk.Name)
+			return
+		}
+		log.Infof("Running check: %s", chk.Name)
+		chk.Run(ctx)
+		next = chk.nextRun(next, time.Now())
+	}
+	log.Warnf("Check %s has no more scheduled runs", chk.Name)
+}
+
+// CurrentChecks returns the checks registered right now, it's safe to call
+// while a reload is in progress.
+func (c *Registry) CurrentChecks() []*HealthCheck {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*HealthCheck(nil), c.Checks...)
+}
+
+// RunOnce runs every check once in parallel and returns the results in the
+// order of Checks. Checks combining the results of others, like composite
+// checks, combine the results of this run. The results are not emitted to
+// sinks.
+func (c *Registry) RunOnce(ctx context.Context) []*Result {
+	checks := c.CurrentChecks()
+	run := &runResults{results: make(map[string]*Result, len(checks))}
+	ctx = context.WithValue(ctx, runResultsKey{}, run)
+
+	results := make([]*Result, len(checks))
+	pending := make([]int, len(checks))
+	for i := range checks {
+		pending[i] = i
+	}
+	// Checks combining the results of others run once those are done.
+	// Checks combining each other in a cycle all run in the last round.
+	for len(pending) > 0 {
+		pendingNames := make(map[string]bool, len(pending))
+		for _, i := range pending {
+			pendingNames[checks[i].Name] = true
+		}
+		ready, waiting := make([]int, 0), make([]int, 0)
+		for _, i := range pending {
+			waits := false
+			for _, name := range checks[i].combines {
+				if name != checks[i].Name && pendingNames[name] {
+					waits = true
 				}
-				log.Infof("Running check: %s", chk.Name)
-				chk.Run()
 			}
-			log.Errorf("Stopping check loop for: %s", chk.Name)
-		}(c.Checks[i])
+			if waits {
+				waiting = append(waiting, i)
+			} else {
+				ready = append(ready, i)
+			}
+		}
+		if len(ready) == 0 {
+			ready, waiting = waiting, nil
+		}
+
+		var wg sync.WaitGroup
+		for _, i := range ready {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = checks[i].Check(ctx)
+				run.set(checks[i].Name, results[i])
+			}(i)
+		}
+		wg.Wait()
+		pending = waiting
 	}
-	wg.Wait()
+	return results
 }
 
 func (c *Registry) StopRunning() {
 	log.Info("Stopping health checks")
-	c.running = false
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// Reload replaces the running checks with the ones in conf. Checks whose
+// config didn't change keep running, as do sinks shared by id, which keep
+// the args they were first created with. If conf is invalid or any of its
+// checks cannot be created the current checks are left untouched and an
+// error is returned.
+func (c *Registry) Reload(conf *Config) error {
+	if err := c.ValidateConfig(conf); err != nil {
+		return err
+	}
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	added, removed, err := c.replaceChecks(conf)
+	if err != nil {
+		return err
+	}
+
+	// Removed checks are waited for without holding mu, so CurrentChecks
+	// doesn't block while they finish. Their sinks are closed once they
+	// stopped and the checks replacing them start after that.
+	c.stopChecks(removed)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeUnusedSinks()
+	if c.runCtx != nil {
+		for _, chk := range added {
+			c.startCheck(chk)
+		}
+	}
+	log.Infof("Reloaded config: %d started, %d stopped, %d unchanged",
+		len(added), len(removed), len(c.Checks)-len(added))
+	return nil
+}
+
+// replaceChecks creates the checks of conf that aren't running yet and swaps
+// them in, returning the added checks and the removed ones.
+func (c *Registry) replaceChecks(conf *Config) (added, removed []*HealthCheck, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	running := make(map[string]*HealthCheck)
+	for _, chk := range c.Checks {
+		if chk.conf != nil {
+			running[chk.Name] = chk
+		}
+	}
+
+	createdMark := len(c.createdSinks)
+	checks := make([]*HealthCheck, 0, len(conf.HealthChecks))
+	added = make([]*HealthCheck, 0)
+	for _, hc := range conf.HealthChecks {
+		old, ok := running[hc.Name]
+		if ok && sameCheckConfig(*old.conf, hc) {
+			checks = append(checks, old)
+			continue
+		}
+		if ok {
+			c.reusableSinks = old.privateSinks
+		}
+		chk, err := c.checkFromConfig(hc)
+		c.reusableSinks = nil
+		if err != nil {
+			c.discardSinks(createdMark)
+			return nil, nil, fmt.Errorf("Rejecting config: could not create %s: %s", hc.Name, err)
+		}
+		checks = append(checks, chk)
+		added = append(added, chk)
+	}
+
+	kept := make(map[*HealthCheck]bool)
+	for _, chk := range checks {
+		kept[chk] = true
+	}
+	removed = make([]*HealthCheck, 0)
+	for _, chk := range c.Checks {
+		if !kept[chk] {
+			removed = append(removed, chk)
+		}
+	}
+	c.Checks = checks
+	c.deps.set(checks)
+	c.Maintenance.SetWindows(conf.Maintenance)
+	return added, removed, nil
+}
+
+// sameCheckConfig compares check configs ignoring where they are in the file.
+func sameCheckConfig(a, b HealthChecksConfig) bool {
+	a.Line, b.Line = 0, 0
+	return reflect.DeepEqual(a, b)
+}
+
+// discardSinks closes the sinks created since createdMark, used to undo a
+// rejected reload.
+func (c *Registry) discardSinks(createdMark int) {
+	c.acquiredSinks, c.builtSinks = nil, nil
+	discarded := c.createdSinks[createdMark:]
+	c.forgetSinks(discarded)
+	c.closeSinks(discarded)
+	c.createdSinks = c.createdSinks[:createdMark]
+}
+
+// closeUnusedSinks closes the sinks no check depends on anymore.
+func (c *Registry) closeUnusedSinks() {
+	inUse := make(map[Emitter]bool)
+	for _, chk := range c.Checks {
+		for _, sink := range chk.sinks {
+			inUse[sink] = true
+		}
+		for _, sink := range chk.sinkDeps {
+			inUse[sink] = true
+		}
+	}
+	live := make([]Emitter, 0, len(c.createdSinks))
+	unused := make([]Emitter, 0)
+	for _, sink := range c.createdSinks {
+		if inUse[sink] {
+			live = append(live, sink)
+		} else {
+			unused = append(unused, sink)
+		}
+	}
+	c.forgetSinks(unused)
+	c.closeSinks(unused)
+	c.createdSinks = live
+}
+
+func (c *Registry) forgetSinks(sinks []Emitter) {
+	for _, sink := range sinks {
+		for id, shared := range c.Sinks {
+			if shared == sink {
+				delete(c.Sinks, id)
+			}
+		}
+	}
+}
+
+// CloseSinks flushes and closes every sink created by the registry that
+// holds on to resources.
+func (c *Registry) CloseSinks() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeSinks(c.createdSinks)
+	c.createdSinks = nil
+}
+
+func (c *Registry) closeSinks(sinks []Emitter) {
+	for _, sink := range sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			log.Debugf("Closing sink: %s", sink.Name())
+			if err := closer.Close(); err != nil {
+				log.Errorf("Error closing sink %s: %s", sink.Name(), err)
+			}
+		}
+	}
 }
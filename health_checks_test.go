@@ -1,13 +1,17 @@
 package healthchecker
 
 import (
+	"context"
 	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-func testingCheckConstructor(_ map[string]string) (func() *Result, error) {
-	return func() *Result {
+func testingCheckConstructor(_ map[string]string) (CheckFunc, error) {
+	return func(_ context.Context) *Result {
 		return &Result{}
 	}, nil
 }
@@ -21,7 +25,7 @@ func TestNewCheckCorrect(t *testing.T) {
 
 func TestNewCheckFail(t *testing.T) {
 	registry := NewRegistry()
-	registry.CheckConstructors["testing"] = func(_ map[string]string) (func() *Result, error) {
+	registry.CheckConstructors["testing"] = func(_ map[string]string) (CheckFunc, error) {
 		return nil, errors.New("Wat")
 	}
 
@@ -31,16 +35,16 @@ func TestNewCheckFail(t *testing.T) {
 func TestStartRunning(t *testing.T) {
 	registry := NewRegistry()
 	var ran = false
-	registry.CheckConstructors["testing"] = func(_ map[string]string) (func() *Result, error) {
+	registry.CheckConstructors["testing"] = func(_ map[string]string) (CheckFunc, error) {
 		ran = true
-		return func() *Result { return nil }, nil
+		return func(_ context.Context) *Result { return nil }, nil
 	}
 
 	sinks := make([]Emitter, 0)
 	registry.AddCheck("some check", "testing", nil, 1, sinks)
 	registry.AddCheck("some check", "testing", nil, 1, sinks)
 
-	go registry.StartRunning()
+	go registry.StartRunning(context.Background())
 	time.Sleep(1100 * time.Millisecond)
 	registry.StopRunning()
 	if !ran {
@@ -48,6 +52,251 @@ func TestStartRunning(t *testing.T) {
 	}
 }
 
+// closingSink counts its calls atomically, it is shared by concurrent checks.
+type closingSink struct {
+	emitted int32
+	closed  int32
+}
+
+func (s *closingSink) Emit(name, checkType string, c *Result, _ *CheckState) {
+	atomic.AddInt32(&s.emitted, 1)
+}
+func (s *closingSink) Name() string { return "closingSink" }
+func (s *closingSink) Close() error {
+	atomic.AddInt32(&s.closed, 1)
+	return nil
+}
+
+func TestStartRunningCancelsInFlightChecks(t *testing.T) {
+	registry := NewRegistry()
+	cancelled := make(chan struct{})
+	registry.CheckConstructors["blocking"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(ctx context.Context) *Result {
+			<-ctx.Done()
+			close(cancelled)
+			return &Result{Result: Failure}
+		}, nil
+	}
+	sink := &closingSink{}
+	registry.SinkConstructors["closing"] = func(_ map[string]string) (Emitter, error) {
+		return sink, nil
+	}
+	sinks, _ := registry.setupSinks("some check", []map[string]map[string]string{{"closing": {}}})
+	registry.AddCheck("some check", "blocking", nil, 60, sinks)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		registry.StartRunning(ctx)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("StartRunning did not return after cancellation")
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Errorf("In-flight check was not cancelled")
+	}
+	if emitted := atomic.LoadInt32(&sink.emitted); emitted != 0 {
+		t.Errorf("Result of cancelled check should not be emitted, got %d", emitted)
+	}
+	if closed := atomic.LoadInt32(&sink.closed); closed != 1 {
+		t.Errorf("Expected sink to be closed once, got %d", closed)
+	}
+}
+
+func TestStopRunningWaitsWithDeadline(t *testing.T) {
+	registry := NewRegistry()
+	registry.ShutdownTimeout = 100 * time.Millisecond
+	registry.CheckConstructors["stuck"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result {
+			time.Sleep(time.Second)
+			return &Result{}
+		}, nil
+	}
+	registry.AddCheck("stuck check", "stuck", nil, 60, nil)
+
+	stopped := make(chan struct{})
+	go func() {
+		registry.StartRunning(context.Background())
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	registry.StopRunning()
+
+	select {
+	case <-stopped:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("StartRunning did not give up on a stuck check after ShutdownTimeout")
+	}
+}
+
+type recordingSink struct {
+	mu      sync.Mutex
+	results []*Result
+	states  []CheckState
+}
+
+func (s *recordingSink) Emit(name, checkType string, c *Result, state *CheckState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, c)
+	if state != nil {
+		s.states = append(s.states, *state)
+	}
+}
+
+func (s *recordingSink) States() []CheckState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CheckState(nil), s.states...)
+}
+
+func (s *recordingSink) Name() string { return "recordingSink" }
+
+func (s *recordingSink) Results() []*Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Result(nil), s.results...)
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	sink := &recordingSink{}
+	chk := &HealthCheck{
+		fn: func(ctx context.Context) *Result {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("Check context has no deadline")
+			}
+			<-ctx.Done()
+			return &Result{Result: Failure, Category: CategoryTimeout}
+		},
+		sinks:    []Emitter{sink},
+		Interval: time.Minute,
+		Timeout:  50 * time.Millisecond,
+		Name:     "slow check",
+		state:    newStateTracker(),
+	}
+
+	timeStart := time.Now()
+	chk.Run(context.Background())
+	if elapsed := time.Since(timeStart); elapsed > 500*time.Millisecond {
+		t.Errorf("Check ran for %s despite a 50ms timeout", elapsed)
+	}
+	if results := sink.Results(); len(results) != 1 || results[0].Result != Failure {
+		t.Errorf("Expected a single Failure result, got: %v", results)
+	}
+}
+
+func TestHealthCheckHardDeadline(t *testing.T) {
+	sink := &recordingSink{}
+	given := make(chan context.Context, 1)
+	chk := &HealthCheck{
+		fn: func(ctx context.Context) *Result {
+			given <- ctx
+			time.Sleep(time.Minute)
+			return &Result{Result: Success}
+		},
+		sinks:    []Emitter{sink},
+		Interval: 100 * time.Millisecond,
+		Name:     "stuck check",
+		state:    newStateTracker(),
+	}
+
+	chk.Run(context.Background())
+	results := sink.Results()
+	if len(results) != 1 || results[0].Result != Error || results[0].Category != CategoryTimeout {
+		t.Errorf("Expected a single timeout Error result, got: %v", results)
+	}
+	select {
+	case <-(<-given).Done():
+	default:
+		t.Errorf("Expected the context of a check given up on to be cancelled")
+	}
+}
+
+func TestHealthCheckRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		retries  int
+		interval time.Duration
+		failures int
+		result   ResultCode
+		attempts int
+	}{
+		{"no retries", 0, time.Minute, 1, Failure, 1},
+		{"recovers", 3, time.Minute, 2, Success, 3},
+		{"gives up", 2, time.Minute, 5, Failure, 3},
+		{"success needs no retry", 3, time.Minute, 0, Success, 1},
+		{"retries must fit in interval", 3, 25 * time.Millisecond, 5, Failure, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			calls := 0
+			chk := &HealthCheck{
+				fn: func(_ context.Context) *Result {
+					calls++
+					if calls <= test.failures {
+						return &Result{Timestamp: time.Now(), Result: Failure}
+					}
+					return &Result{Timestamp: time.Now(), Result: Success}
+				},
+				sinks:    []Emitter{sink},
+				Interval: test.interval,
+				Name:     "retried check",
+				state:    newStateTracker(),
+			}
+			configureCheck(chk, HealthChecksConfig{Retries: test.retries, RetryDelay: 10})
+
+			chk.Run(context.Background())
+			results := sink.Results()
+			if len(results) != 1 {
+				t.Fatalf("Expected a single emitted result, got %d", len(results))
+			}
+			if results[0].Result != test.result || results[0].Attempts != test.attempts || calls != test.attempts {
+				t.Errorf("Expected %s after %d attempts, got %s after %d (%d calls)",
+					test.result, test.attempts, results[0].Result, results[0].Attempts, calls)
+			}
+		})
+	}
+}
+
+func TestHealthCheckRunEmitsState(t *testing.T) {
+	sink := &recordingSink{}
+	outcome := Success
+	chk := &HealthCheck{
+		fn: func(_ context.Context) *Result {
+			return &Result{Timestamp: time.Now(), Result: outcome}
+		},
+		sinks: []Emitter{sink},
+		Name:  "flaky check",
+		state: newStateTracker(),
+	}
+	configureCheck(chk, HealthChecksConfig{FailuresBeforeDown: 2})
+
+	chk.Run(context.Background())
+	outcome = Failure
+	chk.Run(context.Background())
+	chk.Run(context.Background())
+
+	states := sink.States()
+	if len(states) != 3 {
+		t.Fatalf("Expected 3 emitted states, got %d", len(states))
+	}
+	if states[0].Status != StatusUp || states[1].Status != StatusUp || states[2].Status != StatusDown {
+		t.Errorf("Expected up, up, down - got: %s, %s, %s", states[0].Status, states[1].Status, states[2].Status)
+	}
+	if chk.State().Status != StatusDown {
+		t.Errorf("Expected check to be down, got: %s", chk.State().Status)
+	}
+}
+
 func TestRegisterHealthChecks(t *testing.T) {
 	config := &Config{
 		Core: map[string]string{},
@@ -64,6 +313,7 @@ func TestRegisterHealthChecks(t *testing.T) {
 					},
 				},
 				Interval: 5,
+				Timeout:  2,
 			},
 			{
 				Name: "SomeOtherCheck",
@@ -83,9 +333,9 @@ func TestRegisterHealthChecks(t *testing.T) {
 
 	registry := NewRegistry()
 	var ran = false
-	registry.CheckConstructors["testing"] = func(_ map[string]string) (func() *Result, error) {
+	registry.CheckConstructors["testing"] = func(_ map[string]string) (CheckFunc, error) {
 		ran = true
-		return func() *Result { return nil }, nil
+		return func(_ context.Context) *Result { return nil }, nil
 	}
 	registry.SinkConstructors["FileSink"] = NewFileSink
 	registry.RegisterHealthChecks(config)
@@ -105,6 +355,10 @@ func TestRegisterHealthChecks(t *testing.T) {
 	if cName := registry.Checks[1].Name; cName != "SomeOtherCheck" {
 		t.Errorf("Second check should be 'SomeOtherCheck', got: %s", cName)
 	}
+
+	if timeout := registry.Checks[0].Timeout; timeout != 2*time.Second {
+		t.Errorf("First check should have a 2s timeout, got: %s", timeout)
+	}
 }
 
 func TestRegisterHealthChecksWithSameSink(t *testing.T) {
@@ -141,8 +395,8 @@ func TestRegisterHealthChecksWithSameSink(t *testing.T) {
 	}
 
 	registry := NewRegistry()
-	registry.CheckConstructors["testing"] = func(_ map[string]string) (func() *Result, error) {
-		return func() *Result { return nil }, nil
+	registry.CheckConstructors["testing"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result { return nil }, nil
 	}
 	registry.SinkConstructors["FileSink"] = NewFileSink
 	registry.RegisterHealthChecks(config)
@@ -155,3 +409,259 @@ func TestRegisterHealthChecksWithSameSink(t *testing.T) {
 		t.Errorf("Expected 1 sink, got %d", nSinks)
 	}
 }
+
+func TestRegisterHealthChecksSkipSinks(t *testing.T) {
+	registry := newValidatingRegistry()
+	created := 0
+	registry.RegisterSinkType("counting", func(_ map[string]string) (Emitter, error) {
+		created++
+		return &recordingSink{}, nil
+	}, ArgSchema{Args: []ArgSpec{{Name: "count", Type: ArgInt}}})
+	registry.SkipSinks = true
+	check := func(count string) *Config {
+		return &Config{HealthChecks: []HealthChecksConfig{{
+			Name:     "web",
+			Type:     "testing",
+			Args:     map[string]string{"url": "http://example.com"},
+			Sinks:    []map[string]map[string]string{{"counting": {"count": count}}},
+			Interval: 5,
+		}}}
+	}
+
+	if err := registry.RegisterHealthChecks(check("3")); err != nil {
+		t.Fatalf("Couldn't register checks: %s", err)
+	}
+	if created != 0 || len(registry.Checks[0].sinks) != 0 {
+		t.Errorf("Expected no sinks to be created, got %d", created)
+	}
+	if err := registry.ValidateConfig(check("three")); err == nil {
+		t.Errorf("Expected the args of skipped sinks to be validated")
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	registry := NewRegistry()
+	registry.CheckConstructors["testing"] = testingCheckConstructor
+	registry.CheckConstructors["failing"] = func(_ map[string]string) (CheckFunc, error) {
+		return nil, errors.New("can't create check")
+	}
+	var mu sync.Mutex
+	created := make([]*closingSink, 0)
+	registry.SinkConstructors["closing"] = func(_ map[string]string) (Emitter, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sink := &closingSink{}
+		created = append(created, sink)
+		return sink, nil
+	}
+	check := func(name string, interval int, sinkArgs map[string]string) HealthChecksConfig {
+		return HealthChecksConfig{
+			Name:     name,
+			Type:     "testing",
+			Sinks:    []map[string]map[string]string{{"closing": sinkArgs}},
+			Interval: interval,
+		}
+	}
+
+	registry.RegisterHealthChecks(&Config{HealthChecks: []HealthChecksConfig{
+		check("unchanged", 60, map[string]string{"id": "shared"}),
+		check("changed", 60, map[string]string{"id": "shared"}),
+		check("removed", 60, map[string]string{}),
+	}})
+	unchanged, changed := registry.Checks[0], registry.Checks[1]
+	go registry.StartRunning(context.Background())
+	defer registry.StopRunning()
+	time.Sleep(50 * time.Millisecond)
+
+	err := registry.Reload(&Config{HealthChecks: []HealthChecksConfig{
+		check("unchanged", 60, map[string]string{"id": "shared"}),
+		check("changed", 30, map[string]string{"id": "shared"}),
+		check("added", 60, map[string]string{}),
+	}})
+	if err != nil {
+		t.Fatalf("Reload failed: %s", err)
+	}
+	if len(registry.Checks) != 3 {
+		t.Fatalf("Expected 3 checks after reload, got %d", len(registry.Checks))
+	}
+	if registry.Checks[0] != unchanged {
+		t.Errorf("Unchanged check should keep running")
+	}
+	if registry.Checks[1] == changed || registry.Checks[1].Interval != 30*time.Second {
+		t.Errorf("Changed check should be recreated with its new config")
+	}
+	if name := registry.Checks[2].Name; name != "added" {
+		t.Errorf("Expected the added check last, got %s", name)
+	}
+	select {
+	case <-changed.done:
+	default:
+		t.Errorf("Changed check should be stopped")
+	}
+	mu.Lock()
+	if len(created) != 3 {
+		t.Errorf("Expected 3 sinks to be created, got %d", len(created))
+	}
+	shared, removed := atomic.LoadInt32(&created[0].closed), atomic.LoadInt32(&created[1].closed)
+	if shared != 0 || removed != 1 {
+		t.Errorf("Only the sink of the removed check should be closed, got shared: %d, removed: %d", shared, removed)
+	}
+	mu.Unlock()
+
+	err = registry.Reload(&Config{HealthChecks: []HealthChecksConfig{
+		check("new", 60, map[string]string{}),
+		{Name: "broken", Type: "failing", Interval: 60},
+	}})
+	if err == nil {
+		t.Fatalf("Reload of an invalid config should fail")
+	}
+	if len(registry.Checks) != 3 || registry.Checks[0] != unchanged {
+		t.Errorf("Rejected config should keep the current checks")
+	}
+	mu.Lock()
+	if leaked := created[len(created)-1]; atomic.LoadInt32(&leaked.closed) != 1 {
+		t.Errorf("Sinks created for a rejected config should be closed")
+	}
+	mu.Unlock()
+
+	err = registry.Reload(&Config{HealthChecks: []HealthChecksConfig{
+		{Name: "unknown", Type: "unknown", Interval: 60},
+	}})
+	if err == nil {
+		t.Fatalf("Reload of a config with an unknown check type should fail")
+	}
+	if len(registry.Checks) != 3 || registry.Checks[0] != unchanged {
+		t.Errorf("Rejected config should keep the current checks")
+	}
+}
+
+func TestRegistryReloadDoesNotBlockCurrentChecks(t *testing.T) {
+	registry := NewRegistry()
+	registry.ShutdownTimeout = 500 * time.Millisecond
+	registry.CheckConstructors["testing"] = testingCheckConstructor
+	registry.CheckConstructors["stuck"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result {
+			time.Sleep(time.Second)
+			return &Result{}
+		}, nil
+	}
+	registry.RegisterHealthChecks(&Config{HealthChecks: []HealthChecksConfig{
+		{Name: "stuck", Type: "stuck", Interval: 60},
+	}})
+	go registry.StartRunning(context.Background())
+	defer registry.StopRunning()
+	time.Sleep(50 * time.Millisecond)
+
+	reloaded := make(chan error)
+	go func() {
+		reloaded <- registry.Reload(&Config{HealthChecks: []HealthChecksConfig{
+			{Name: "new", Type: "testing", Interval: 60},
+		}})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	timeStart := time.Now()
+	checks := registry.CurrentChecks()
+	if elapsed := time.Since(timeStart); elapsed > 100*time.Millisecond {
+		t.Errorf("CurrentChecks waited %s for the removed check to stop", elapsed)
+	}
+	if len(checks) != 1 || checks[0].Name != "new" {
+		t.Errorf("Expected the new checks while the old ones stop, got %v", checks)
+	}
+	if err := <-reloaded; err != nil {
+		t.Errorf("Reload failed: %s", err)
+	}
+}
+
+type listeningSink struct {
+	net.Listener
+}
+
+func (s *listeningSink) Emit(name, checkType string, c *Result, _ *CheckState) {}
+func (s *listeningSink) Name() string                                          { return "listeningSink" }
+
+func TestRegistryReloadListeningSink(t *testing.T) {
+	registry := NewRegistry()
+	registry.CheckConstructors["testing"] = testingCheckConstructor
+	registry.SinkConstructors["listening"] = func(args map[string]string) (Emitter, error) {
+		ln, err := net.Listen("tcp", args["addr"])
+		if err != nil {
+			return nil, err
+		}
+		return &listeningSink{ln}, nil
+	}
+	freeAddr := func() string {
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer ln.Close()
+		return ln.Addr().String()
+	}
+	check := func(interval int, addr string) *Config {
+		return &Config{HealthChecks: []HealthChecksConfig{{
+			Name:     "web",
+			Type:     "testing",
+			Sinks:    []map[string]map[string]string{{"listening": {"addr": addr}}},
+			Interval: interval,
+		}}}
+	}
+	addr := freeAddr()
+	if err := registry.RegisterHealthChecks(check(60, addr)); err != nil {
+		t.Fatalf("Couldn't register checks: %s", err)
+	}
+	sink := registry.Checks[0].sinks[0]
+
+	// The changed check keeps its sink, which it couldn't create again while
+	// the old one is listening.
+	if err := registry.Reload(check(30, addr)); err != nil {
+		t.Fatalf("Reload of a check with a listening sink failed: %s", err)
+	}
+	if registry.Checks[0].sinks[0] != sink {
+		t.Errorf("Expected the sink with unchanged args to be kept")
+	}
+	if err := registry.Reload(check(15, addr)); err != nil {
+		t.Fatalf("Second reload of a check with a listening sink failed: %s", err)
+	}
+
+	if err := registry.Reload(check(15, freeAddr())); err != nil {
+		t.Fatalf("Reload with a new listening address failed: %s", err)
+	}
+	if registry.Checks[0].sinks[0] == sink {
+		t.Errorf("Expected a sink with changed args to be created again")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Expected the replaced sink to be closed: %s", err)
+	}
+	ln.Close()
+	registry.CloseSinks()
+}
+
+func TestRegistryRunOnce(t *testing.T) {
+	registry := NewRegistry()
+	registry.CheckConstructors["result"] = func(args map[string]string) (CheckFunc, error) {
+		code := Success
+		if args["fail"] == "true" {
+			code = Failure
+		}
+		return func(_ context.Context) *Result { return &Result{Result: code} }, nil
+	}
+	registry.CheckConstructors["nil"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result { return nil }, nil
+	}
+	sink := &recordingSink{}
+	registry.AddCheck("passing", "result", nil, 60, []Emitter{sink})
+	registry.AddCheck("failing", "result", map[string]string{"fail": "true"}, 60, []Emitter{sink})
+	registry.AddCheck("empty", "nil", nil, 60, []Emitter{sink})
+
+	results := registry.RunOnce(context.Background())
+	expected := []ResultCode{Success, Failure, Error}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, code := range expected {
+		if results[i].Result != code {
+			t.Errorf("Result %d: got %s, wanted %s", i, results[i].Result, code)
+		}
+	}
+	if emitted := len(sink.Results()); emitted != 0 {
+		t.Errorf("RunOnce should not emit results, got %d", emitted)
+	}
+}
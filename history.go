@@ -0,0 +1,150 @@
+package healthchecker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistoryRetention  = 90 * hoursInDay * time.Hour
+	defaultHistoryMaxEntries = 200000
+)
+
+// HistoryEntry is a Result as recorded in a check's history, along with the
+// state the check was in after it.
+type HistoryEntry struct {
+	Timestamp time.Time
+	Result    ResultCode
+	Duration  time.Duration
+	Message   string
+	Category  ErrorCategory
+	Status    Status
+	// Maintenance entries are left out of uptime and incidents.
+	Maintenance bool
+}
+
+// observed reports whether the entry counts towards uptime and incidents,
+// entries in maintenance or while upstream was down don't.
+func (e *HistoryEntry) observed() bool {
+	return !e.Maintenance && e.Result != UpstreamDown
+}
+
+func NewHistoryEntry(res *Result, state *CheckState) HistoryEntry {
+	entry := HistoryEntry{
+		Timestamp:   res.Timestamp,
+		Result:      res.Result,
+		Duration:    res.Duration,
+		Message:     res.Message,
+		Category:    res.Category,
+		Maintenance: res.Maintenance,
+	}
+	if state != nil {
+		entry.Status = state.Status
+	}
+	return entry
+}
+
+// History records the results of every check, see Registry.History.
+type History interface {
+	Record(name string, entry HistoryEntry) error
+	// Entries returns the entries of the named check from from up to, but
+	// not including, to, oldest first. A zero to means no upper bound.
+	Entries(name string, from, to time.Time) ([]HistoryEntry, error)
+}
+
+// MemoryHistory keeps check history in memory, dropping entries older than
+// Retention and the oldest ones once a check has MaxEntries.
+type MemoryHistory struct {
+	Retention  time.Duration
+	MaxEntries int
+	mu         sync.Mutex
+	entries    map[string][]HistoryEntry
+}
+
+func NewMemoryHistory(retention time.Duration) *MemoryHistory {
+	if retention <= 0 {
+		retention = defaultHistoryRetention
+	}
+	return &MemoryHistory{
+		Retention:  retention,
+		MaxEntries: defaultHistoryMaxEntries,
+		entries:    make(map[string][]HistoryEntry),
+	}
+}
+
+func (m *MemoryHistory) Record(name string, entry HistoryEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := append(m.entries[name], entry)
+	cutoff := entry.Timestamp.Add(-m.Retention)
+	drop := sort.Search(len(entries), func(i int) bool {
+		return !entries[i].Timestamp.Before(cutoff)
+	})
+	if m.MaxEntries > 0 && len(entries)-drop > m.MaxEntries {
+		drop = len(entries) - m.MaxEntries
+	}
+	if drop > 0 {
+		// Copy so the dropped entries can be garbage collected.
+		entries = append([]HistoryEntry(nil), entries[drop:]...)
+	}
+	m.entries[name] = entries
+	return nil
+}
+
+func (m *MemoryHistory) Entries(name string, from, to time.Time) ([]HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.entries[name]
+	start := sort.Search(len(entries), func(i int) bool {
+		return !entries[i].Timestamp.Before(from)
+	})
+	end := len(entries)
+	if !to.IsZero() {
+		end = sort.Search(len(entries), func(i int) bool {
+			return !entries[i].Timestamp.Before(to)
+		})
+	}
+	if end < start {
+		end = start
+	}
+	return append([]HistoryEntry(nil), entries[start:end]...), nil
+}
+
+// Incident is a period during which a check was down. End is zero while the
+// incident is ongoing.
+type Incident struct {
+	Check   string
+	Start   time.Time
+	End     time.Time
+	Message string
+}
+
+func (i Incident) Ongoing() bool {
+	return i.End.IsZero()
+}
+
+// Incidents finds the periods in entries during which the check was down,
+// oldest first. Entries in maintenance or while upstream was down neither
+// start nor end incidents.
+func Incidents(name string, entries []HistoryEntry) []Incident {
+	incidents := make([]Incident, 0)
+	var current *Incident
+	for _, entry := range entries {
+		if !entry.observed() {
+			continue
+		}
+		down := entry.Status == StatusDown
+		if down && current == nil {
+			current = &Incident{Check: name, Start: entry.Timestamp, Message: entry.Message}
+		} else if !down && current != nil {
+			current.End = entry.Timestamp
+			incidents = append(incidents, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		incidents = append(incidents, *current)
+	}
+	return incidents
+}
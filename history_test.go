@@ -0,0 +1,96 @@
+package healthchecker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryHistory(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := NewMemoryHistory(time.Hour)
+	history.MaxEntries = 50
+	for i := 0; i < 100; i++ {
+		history.Record("check", HistoryEntry{Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	entries, _ := history.Entries("check", time.Time{}, time.Time{})
+	if len(entries) != 50 {
+		t.Fatalf("Expected MaxEntries to be kept, got %d", len(entries))
+	}
+	if first := entries[0].Timestamp; !first.Equal(start.Add(50 * time.Minute)) {
+		t.Errorf("Expected the oldest entries to be dropped, first is: %s", first)
+	}
+
+	history.MaxEntries = 0
+	history.Record("check", HistoryEntry{Timestamp: start.Add(200 * time.Minute)})
+	entries, _ = history.Entries("check", time.Time{}, time.Time{})
+	if len(entries) != 1 {
+		t.Errorf("Expected entries older than Retention to be dropped, got %d", len(entries))
+	}
+
+	entries, _ = history.Entries("check", start.Add(201*time.Minute), time.Time{})
+	if len(entries) != 0 {
+		t.Errorf("Expected no entries after since, got %d", len(entries))
+	}
+	if entries, _ := history.Entries("other", time.Time{}, time.Time{}); len(entries) != 0 {
+		t.Errorf("Expected no entries for unknown check, got %d", len(entries))
+	}
+}
+
+func TestIncidents(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+	entries := []HistoryEntry{
+		{Timestamp: at(0), Status: StatusUp},
+		{Timestamp: at(1), Status: StatusDown, Message: "refused"},
+		{Timestamp: at(2), Status: StatusDown, Message: "timeout"},
+		{Timestamp: at(3), Status: StatusUp},
+		{Timestamp: at(4), Status: StatusDown, Message: "refused"},
+	}
+
+	incidents := Incidents("check", entries)
+	if len(incidents) != 2 {
+		t.Fatalf("Expected 2 incidents, got %d", len(incidents))
+	}
+	first := incidents[0]
+	if !first.Start.Equal(at(1)) || !first.End.Equal(at(3)) || first.Message != "refused" || first.Ongoing() {
+		t.Errorf("Unexpected first incident: %+v", first)
+	}
+	if !incidents[1].Ongoing() || !incidents[1].Start.Equal(at(4)) {
+		t.Errorf("Expected second incident to be ongoing: %+v", incidents[1])
+	}
+}
+
+func TestHealthCheckRunRecordsHistory(t *testing.T) {
+	registry := NewRegistry()
+	registry.History = NewMemoryHistory(0)
+	registry.CheckConstructors["failing"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result {
+			return &Result{Timestamp: time.Now(), Result: Failure, Message: "nope"}
+		}, nil
+	}
+	chk, _ := registry.AddCheck("check", "failing", nil, 60, nil)
+	chk.Run(context.Background())
+
+	entries, _ := registry.History.Entries("check", time.Time{}, time.Time{})
+	if len(entries) != 1 || entries[0].Result != Failure || entries[0].Status != StatusDown || entries[0].Message != "nope" {
+		t.Errorf("Unexpected history: %+v", entries)
+	}
+}
+
+func TestNewCheckRestoresStateFromHistory(t *testing.T) {
+	registry := NewRegistry()
+	registry.History = NewMemoryHistory(0)
+	registry.History.Record("check", HistoryEntry{Timestamp: time.Now().Add(-time.Minute), Result: Failure, Status: StatusDown})
+	registry.CheckConstructors["testing"] = testingCheckConstructor
+
+	chk, _ := registry.AddCheck("check", "testing", nil, 60, nil)
+	if status := chk.State().Status; status != StatusDown {
+		t.Errorf("Expected state to be restored as down, got %s", status)
+	}
+	other, _ := registry.AddCheck("other", "testing", nil, 60, nil)
+	if status := other.State().Status; status != StatusUnknown {
+		t.Errorf("Expected check without history to be unknown, got %s", status)
+	}
+}
@@ -1,9 +1,9 @@
 package healthchecker
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"regexp"
 	"time"
@@ -12,7 +12,8 @@ import (
 )
 
 type HTTPChecker struct {
-	Client *http.Client
+	Client  *http.Client
+	Timeout time.Duration
 }
 
 func NewHTTPChecker(timeout time.Duration) *HTTPChecker {
@@ -21,82 +22,97 @@ func NewHTTPChecker(timeout time.Duration) *HTTPChecker {
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
 			},
-			Timeout: timeout,
 		},
+		Timeout: timeout,
 	}
 	return &checker
 }
 
-func (h *HTTPChecker) checkAndTimeResponse(url string, checkFn func(*http.Response) ResultCode) (ResultCode, time.Duration) {
+func (h *HTTPChecker) checkAndTimeResponse(ctx context.Context, url string, checkFn func(*http.Response, *Result)) *Result {
+	ctx, cancel := withDefaultTimeout(ctx, h.Timeout)
+	defer cancel()
 	timeStart := time.Now()
-	resp, err := h.Client.Get(url)
-	timeElapsed := time.Since(timeStart)
+	resp, err := h.get(ctx, url)
+	res := &Result{
+		Timestamp: timeStart,
+		Result:    Success,
+		Duration:  time.Since(timeStart),
+	}
 	if err != nil {
 		log.Debugf("checkAndTimeResponse to %s failed: %v", url, err)
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return Failure, timeElapsed
-		}
-		return Error, timeElapsed
+		code, category := classifyNetError(err)
+		res.Fail(code, category, "%s", err)
+		return res
 	}
 	defer resp.Body.Close()
-	return checkFn(resp), timeElapsed
+	res.SetMetric("status_code", float64(resp.StatusCode))
+	checkFn(resp, res)
+	return res
+}
+
+func (h *HTTPChecker) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return h.Client.Do(req.WithContext(ctx))
 }
 
-func (h *HTTPChecker) checkStatusCode(rsp *http.Response) ResultCode {
+func (h *HTTPChecker) checkStatusCode(rsp *http.Response, res *Result) {
 	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
-		return Failure
+		res.Fail(Failure, CategoryStatus, "HTTP %s", rsp.Status)
 	}
-	return Success
 }
 
-func (h *HTTPChecker) checkBodyForRegexp(rsp *http.Response, reg *regexp.Regexp) ResultCode {
-	if res := h.checkStatusCode(rsp); res != Success {
-		return res
+func (h *HTTPChecker) checkBodyForRegexp(rsp *http.Response, res *Result, reg *regexp.Regexp) {
+	if h.checkStatusCode(rsp, res); res.Result != Success {
+		return
 	}
 	// TODO: stream the Body?
-	rspBody, _ := ioutil.ReadAll(rsp.Body)
+	rspBody, err := ioutil.ReadAll(rsp.Body)
+	res.SetMetric("bytes_read", float64(len(rspBody)))
+	if err != nil {
+		code, category := classifyNetError(err)
+		res.Fail(code, category, "couldn't read body: %s", err)
+		return
+	}
 	if !reg.MatchString(string(rspBody)) {
-		return Failure
+		res.Fail(Failure, CategoryContent, "body did not match regexp %q", reg)
 	}
-	return Success
 }
 
-func (h *HTTPChecker) SimpleHTTPCheck(url string) *Result {
-	checkTime := time.Now()
-	outcome, duration := h.checkAndTimeResponse(url, h.checkStatusCode)
-	return &Result{
-		Timestamp: checkTime,
-		Result:    outcome,
-		Duration:  duration,
-	}
+func (h *HTTPChecker) SimpleHTTPCheck(ctx context.Context, url string) *Result {
+	return h.checkAndTimeResponse(ctx, url, h.checkStatusCode)
 }
 
-func (h *HTTPChecker) RegexpHTTPCheck(url string, rex *regexp.Regexp) *Result {
-	checkTime := time.Now()
-	bodyCheckWrapper := func(rsp *http.Response) ResultCode {
-		return h.checkBodyForRegexp(rsp, rex)
-	}
-	outcome, duration := h.checkAndTimeResponse(url, bodyCheckWrapper)
-	return &Result{
-		Timestamp: checkTime,
-		Result:    outcome,
-		Duration:  duration,
+func (h *HTTPChecker) RegexpHTTPCheck(ctx context.Context, url string, rex *regexp.Regexp) *Result {
+	bodyCheckWrapper := func(rsp *http.Response, res *Result) {
+		h.checkBodyForRegexp(rsp, res, rex)
 	}
+	return h.checkAndTimeResponse(ctx, url, bodyCheckWrapper)
 }
 
-func (h *HTTPChecker) NewSimpleHTTPCheck(args map[string]string) (func() *Result, error) {
+var SimpleHTTPCheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "url", Type: ArgURL, Required: true, Description: "URL to request"},
+}}
+
+var RegexpHTTPCheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "url", Type: ArgURL, Required: true, Description: "URL to request"},
+	{Name: "checkRegexp", Type: ArgRegexp, Required: true, Description: "regexp the response body must match"},
+}}
+
+func (h *HTTPChecker) NewSimpleHTTPCheck(args map[string]string) (CheckFunc, error) {
 	var url string
 	var ok bool
 	if url, ok = args["url"]; !ok {
 		return nil, fmt.Errorf("SimpleHTTPCheck missing 'url' parameter")
 	}
-	return func() *Result {
-		return h.SimpleHTTPCheck(url)
+	return func(ctx context.Context) *Result {
+		return h.SimpleHTTPCheck(ctx, url)
 	}, nil
 }
 
-func (h *HTTPChecker) NewRegexpHTTPCheck(args map[string]string) (func() *Result, error) {
-	// TODO abstract argument checking
+func (h *HTTPChecker) NewRegexpHTTPCheck(args map[string]string) (CheckFunc, error) {
 	var url, checkRegexp string
 	var ok bool
 	if url, ok = args["url"]; !ok {
@@ -105,8 +121,11 @@ func (h *HTTPChecker) NewRegexpHTTPCheck(args map[string]string) (func() *Result
 	if checkRegexp, ok = args["checkRegexp"]; !ok {
 		return nil, fmt.Errorf("RegexpHTTPCheck missing 'checkRegexp' parameter")
 	}
-	regexpArg := regexp.MustCompile(checkRegexp)
-	return func() *Result {
-		return h.RegexpHTTPCheck(url, regexpArg)
+	regexpArg, err := regexp.Compile(checkRegexp)
+	if err != nil {
+		return nil, fmt.Errorf("RegexpHTTPCheck 'checkRegexp' is not a valid regexp: %s", err)
+	}
+	return func(ctx context.Context) *Result {
+		return h.RegexpHTTPCheck(ctx, url, regexpArg)
 	}, nil
 }
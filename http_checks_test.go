@@ -1,6 +1,7 @@
 package healthchecker
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	ht "net/http/httptest"
@@ -16,7 +17,7 @@ func TestSimpleHTTPCheckPass(t *testing.T) {
 
 	checker := NewHTTPChecker(1 * time.Second)
 	checkerFunc, _ := checker.NewSimpleHTTPCheck(map[string]string{"url": ts.URL})
-	res := checkerFunc()
+	res := checkerFunc(context.Background())
 	if res.Result != Success {
 		t.Errorf("Failed with result: %v", res)
 	}
@@ -31,7 +32,7 @@ func TestSimpleHTTPCheckFail(t *testing.T) {
 
 	checker := NewHTTPChecker(1 * time.Second)
 	checkerFunc, _ := checker.NewSimpleHTTPCheck(map[string]string{"url": ts.URL})
-	res := checkerFunc()
+	res := checkerFunc(context.Background())
 	if res.Result == Success {
 		t.FailNow()
 	}
@@ -48,12 +49,29 @@ func TestSimpleHTTPCheckTimeout(t *testing.T) {
 
 	checker := NewHTTPChecker(100 * time.Millisecond)
 	checkerFunc, _ := checker.NewSimpleHTTPCheck(map[string]string{"url": ts.URL})
-	res := checkerFunc()
+	res := checkerFunc(context.Background())
 	if res.Result == Success || res.Duration < timeoutSleep {
 		t.Fail()
 	}
 }
 
+func TestSimpleHTTPCheckContextTimeoutOverridesDefault(t *testing.T) {
+	ts := ht.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("Slow report"))
+	}))
+	defer ts.Close()
+
+	checker := NewHTTPChecker(50 * time.Millisecond)
+	checkerFunc, _ := checker.NewSimpleHTTPCheck(map[string]string{"url": ts.URL})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res := checkerFunc(ctx)
+	if res.Result != Success {
+		t.Errorf("Per-check timeout should override checker default, got: %v", res)
+	}
+}
+
 func TestRegexpHTTPCheckPass(t *testing.T) {
 	ts := ht.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "Hello world")
@@ -69,7 +87,7 @@ func TestRegexpHTTPCheckPass(t *testing.T) {
 		t.Error(err)
 	}
 
-	res := checkerFunc()
+	res := checkerFunc(context.Background())
 	if res.Result != Success {
 		t.Errorf("Failed with result: %v", res)
 	}
@@ -91,7 +109,7 @@ func TestRegexpHTTPCheckFailStatus(t *testing.T) {
 		t.Error(err)
 	}
 
-	res := checkerFunc()
+	res := checkerFunc(context.Background())
 	if res.Result == Success {
 		t.Fail()
 	}
@@ -112,12 +130,23 @@ func TestRegexpHTTPCheckFailMatch(t *testing.T) {
 		t.Error(err)
 	}
 
-	res := checkerFunc()
+	res := checkerFunc(context.Background())
 	if res.Result == Success {
 		t.Fail()
 	}
 }
 
+func TestRegexpHTTPCheckBadRegexp(t *testing.T) {
+	checker := NewHTTPChecker(1 * time.Second)
+	_, err := checker.NewRegexpHTTPCheck(map[string]string{
+		"url":         "http://example.com",
+		"checkRegexp": "He(llo",
+	})
+	if err == nil {
+		t.Errorf("Expected an error for an invalid regexp")
+	}
+}
+
 func TestSimpleHTTPCheckNoURLArg(t *testing.T) {
 	checker := NewHTTPChecker(1 * time.Second)
 	_, err := checker.NewSimpleHTTPCheck(map[string]string{})
@@ -125,3 +154,48 @@ func TestSimpleHTTPCheckNoURLArg(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestHTTPCheckResultDetails(t *testing.T) {
+	ts := ht.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "Bye world")
+	}))
+	defer ts.Close()
+
+	checker := NewHTTPChecker(1 * time.Second)
+	simpleFunc, _ := checker.NewSimpleHTTPCheck(map[string]string{"url": ts.URL + "/down"})
+	regexpFunc, _ := checker.NewRegexpHTTPCheck(map[string]string{"url": ts.URL, "checkRegexp": "Hello"})
+	refusedFunc, _ := checker.NewSimpleHTTPCheck(map[string]string{"url": "http://127.0.0.1:1"})
+
+	detailTests := []struct {
+		name       string
+		res        *Result
+		category   ErrorCategory
+		message    string
+		statusCode float64
+	}{
+		{"status", simpleFunc(context.Background()), CategoryStatus, "HTTP 503 Service Unavailable", 503},
+		{"regexp", regexpFunc(context.Background()), CategoryContent, `body did not match regexp "Hello"`, 200},
+		{"refused", refusedFunc(context.Background()), CategoryConnection, "", 0},
+	}
+
+	for _, tt := range detailTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.res.Category != tt.category {
+				t.Errorf("Expected category %q, got: %q", tt.category, tt.res.Category)
+			}
+			if tt.message != "" && tt.res.Message != tt.message {
+				t.Errorf("Expected message %q, got: %q", tt.message, tt.res.Message)
+			}
+			if tt.res.Message == "" {
+				t.Errorf("Expected a message for a %s result", tt.res.Result)
+			}
+			if tt.res.Metrics["status_code"] != tt.statusCode {
+				t.Errorf("Expected status_code %v, got: %v", tt.statusCode, tt.res.Metrics["status_code"])
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package healthchecker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MaintenanceScope selects checks by name, type or tag. A check matching any
+// of them is in scope.
+type MaintenanceScope struct {
+	Checks []string `json:"checks,omitempty"`
+	Types  []string `json:"types,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+func (s MaintenanceScope) empty() bool {
+	return len(s.Checks) == 0 && len(s.Types) == 0 && len(s.Tags) == 0
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether chk is in scope, an empty scope matches every check.
+func (s MaintenanceScope) Matches(chk *HealthCheck) bool {
+	if s.empty() {
+		return true
+	}
+	if contains(s.Checks, chk.Name) || contains(s.Types, chk.Type) {
+		return true
+	}
+	for _, tag := range chk.Tags {
+		if contains(s.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaintenanceConfig is a planned maintenance window from the config. It
+// either recurs during Windows, in the same format as a check's active
+// windows, or lasts from Start to End once.
+type MaintenanceConfig struct {
+	Name     string
+	Windows  []string
+	Timezone string
+	Start    string
+	End      string
+	Checks   []string
+	Types    []string
+	Tags     []string
+}
+
+type maintenanceWindow struct {
+	name      string
+	scope     MaintenanceScope
+	recurring *WindowedSchedule
+	start     time.Time
+	end       time.Time
+}
+
+func (w *maintenanceWindow) active(t time.Time) bool {
+	if w.recurring != nil {
+		return w.recurring.Active(t)
+	}
+	return !t.Before(w.start) && t.Before(w.end)
+}
+
+func newMaintenanceWindow(conf MaintenanceConfig) (*maintenanceWindow, error) {
+	window := &maintenanceWindow{
+		name:  conf.Name,
+		scope: MaintenanceScope{Checks: conf.Checks, Types: conf.Types, Tags: conf.Tags},
+	}
+	if conf.Name == "" {
+		return nil, fmt.Errorf("missing 'name'")
+	}
+	if len(conf.Windows) > 0 {
+		if conf.Start != "" || conf.End != "" {
+			return nil, fmt.Errorf("'windows' and 'start'/'end' cannot both be set")
+		}
+		schedule, err := ScheduleFromConfig(HealthChecksConfig{Timezone: conf.Timezone, ActiveWindows: conf.Windows})
+		if err != nil {
+			return nil, err
+		}
+		window.recurring = schedule.(*WindowedSchedule)
+		return window, nil
+	}
+	var err error
+	if window.start, err = time.Parse(time.RFC3339, conf.Start); err != nil {
+		return nil, fmt.Errorf("'start' must be an RFC3339 time, got: %s", conf.Start)
+	}
+	if window.end, err = time.Parse(time.RFC3339, conf.End); err != nil {
+		return nil, fmt.Errorf("'end' must be an RFC3339 time, got: %s", conf.End)
+	}
+	if !window.end.After(window.start) {
+		return nil, fmt.Errorf("'end' must be after 'start'")
+	}
+	return window, nil
+}
+
+func maintenanceLocation(conf MaintenanceConfig) string {
+	return fmt.Sprintf("maintenance '%s'", conf.Name)
+}
+
+// Silence is an ad hoc maintenance window created through the API, lasting
+// from Start until Expires. It needs a scope unless All is set.
+type Silence struct {
+	ID string `json:"id"`
+	MaintenanceScope
+	All     bool      `json:"all,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	Start   time.Time `json:"start"`
+	Expires time.Time `json:"expires"`
+}
+
+func (s *Silence) active(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.Expires)
+}
+
+// Maintenance decides whether a check is in maintenance, either during one
+// of the windows from the config or while a silence is active. Silences are
+// saved to Path, if set, so they survive restarts.
+type Maintenance struct {
+	Path     string
+	mu       sync.Mutex
+	windows  []*maintenanceWindow
+	silences []Silence
+}
+
+func NewMaintenance() *Maintenance {
+	return &Maintenance{silences: make([]Silence, 0)}
+}
+
+// SetWindows replaces the maintenance windows, skipping invalid ones.
+func (m *Maintenance) SetWindows(configs []MaintenanceConfig) {
+	windows := make([]*maintenanceWindow, 0, len(configs))
+	for _, conf := range configs {
+		window, err := newMaintenanceWindow(conf)
+		if err != nil {
+			log.Errorf("Skipping invalid maintenance window, %s: %s", maintenanceLocation(conf), err)
+			continue
+		}
+		windows = append(windows, window)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windows = windows
+}
+
+// Reason returns why chk is in maintenance at t, if it is.
+func (m *Maintenance) Reason(chk *HealthCheck, t time.Time) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, window := range m.windows {
+		if window.active(t) && window.scope.Matches(chk) {
+			return fmt.Sprintf("maintenance '%s'", window.name), true
+		}
+	}
+	for _, silence := range m.silences {
+		if silence.active(t) && (silence.All || silence.Matches(chk)) {
+			return fmt.Sprintf("silence %s", silence.ID), true
+		}
+	}
+	return "", false
+}
+
+// Silences returns the silences that haven't expired yet.
+func (m *Maintenance) Silences() []Silence {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneSilences(time.Now())
+	return append([]Silence(nil), m.silences...)
+}
+
+func (m *Maintenance) pruneSilences(now time.Time) {
+	current := m.silences[:0]
+	for _, silence := range m.silences {
+		if now.Before(silence.Expires) {
+			current = append(current, silence)
+		}
+	}
+	m.silences = current
+}
+
+// AddSilence validates silence, gives it an ID and a Start of now if it has
+// none and saves it.
+func (m *Maintenance) AddSilence(silence Silence) (Silence, error) {
+	now := time.Now()
+	if silence.Start.IsZero() {
+		silence.Start = now
+	}
+	if silence.empty() && !silence.All {
+		return silence, fmt.Errorf("silence needs checks, types or tags to match, or all set")
+	}
+	if !silence.Expires.After(now) || !silence.Expires.After(silence.Start) {
+		return silence, fmt.Errorf("silence must expire in the future and after it starts")
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return silence, err
+	}
+	silence.ID = hex.EncodeToString(id)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneSilences(now)
+	m.silences = append(m.silences, silence)
+	m.save()
+	return silence, nil
+}
+
+// ExpireSilence ends the silence with the given ID right away.
+func (m *Maintenance) ExpireSilence(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, silence := range m.silences {
+		if silence.ID == id {
+			m.silences = append(m.silences[:i], m.silences[i+1:]...)
+			m.save()
+			return nil
+		}
+	}
+	return fmt.Errorf("no silence with id '%s'", id)
+}
+
+// save writes the silences to Path. Silences apply whether or not they
+// could be saved, so failures are only logged.
+func (m *Maintenance) save() {
+	if m.Path == "" {
+		return
+	}
+	contents, err := json.MarshalIndent(m.silences, "", "  ")
+	if err == nil {
+		tmpPath := m.Path + ".tmp"
+		if err = ioutil.WriteFile(tmpPath, contents, 0640); err == nil {
+			err = os.Rename(tmpPath, m.Path)
+		}
+	}
+	if err != nil {
+		log.Errorf("Error saving silences to %s: %s", m.Path, err)
+	}
+}
+
+// LoadSilences reads the silences saved in path and keeps saving them there.
+func (m *Maintenance) LoadSilences(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Path = path
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error loading silences: %s", err)
+	}
+	silences := make([]Silence, 0)
+	if err := json.Unmarshal(contents, &silences); err != nil {
+		return fmt.Errorf("Error loading silences from %s: %s", path, err)
+	}
+	m.silences = silences
+	m.pruneSilences(time.Now())
+	return nil
+}
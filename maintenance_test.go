@@ -0,0 +1,191 @@
+package healthchecker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceScope(t *testing.T) {
+	chk := &HealthCheck{Name: "web", Type: "SimpleHTTPCheck", Tags: []string{"frontend", "eu"}}
+	scopeTests := []struct {
+		name    string
+		scope   MaintenanceScope
+		matches bool
+	}{
+		{"empty", MaintenanceScope{}, true},
+		{"by name", MaintenanceScope{Checks: []string{"db", "web"}}, true},
+		{"by type", MaintenanceScope{Types: []string{"SimpleHTTPCheck"}}, true},
+		{"by tag", MaintenanceScope{Tags: []string{"eu"}}, true},
+		{"other name", MaintenanceScope{Checks: []string{"db"}}, false},
+		{"other tag and type", MaintenanceScope{Types: []string{"DNSCheck"}, Tags: []string{"us"}}, false},
+	}
+
+	for _, tt := range scopeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matches := tt.scope.Matches(chk); matches != tt.matches {
+				t.Errorf("Expected %+v matching to be %v", tt.scope, tt.matches)
+			}
+		})
+	}
+}
+
+func TestNewMaintenanceWindow(t *testing.T) {
+	windowTests := []struct {
+		name    string
+		conf    MaintenanceConfig
+		succeed bool
+	}{
+		{"recurring", MaintenanceConfig{Name: "deploys", Windows: []string{"Tue 02:00-04:00"}, Timezone: "Europe/Warsaw"}, true},
+		{"one-off", MaintenanceConfig{Name: "migration", Start: "2026-03-01T22:00:00Z", End: "2026-03-02T02:00:00Z"}, true},
+		{"missing name", MaintenanceConfig{Windows: []string{"Tue 02:00-04:00"}}, false},
+		{"invalid window", MaintenanceConfig{Name: "deploys", Windows: []string{"Tue 02:00"}}, false},
+		{"windows and start", MaintenanceConfig{Name: "deploys", Windows: []string{"Tue 02:00-04:00"}, Start: "2026-03-01T22:00:00Z"}, false},
+		{"missing end", MaintenanceConfig{Name: "migration", Start: "2026-03-01T22:00:00Z"}, false},
+		{"end before start", MaintenanceConfig{Name: "migration", Start: "2026-03-01T22:00:00Z", End: "2026-03-01T21:00:00Z"}, false},
+	}
+
+	for _, tt := range windowTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newMaintenanceWindow(tt.conf)
+			if tt.succeed && err != nil {
+				t.Errorf("Expected %+v to succeed, got: %s", tt.conf, err)
+			} else if !tt.succeed && err == nil {
+				t.Errorf("Expected %+v to fail", tt.conf)
+			}
+		})
+	}
+}
+
+func TestMaintenanceReason(t *testing.T) {
+	m := NewMaintenance()
+	m.SetWindows([]MaintenanceConfig{
+		{Name: "deploys", Windows: []string{"Tue 02:00-04:00"}, Tags: []string{"frontend"}},
+		{Name: "migration", Start: "2026-03-05T22:00:00Z", End: "2026-03-06T02:00:00Z", Checks: []string{"db"}},
+		{Name: "invalid", Windows: []string{"whenever"}},
+	})
+	web := &HealthCheck{Name: "web", Tags: []string{"frontend"}}
+	db := &HealthCheck{Name: "db"}
+
+	// 2026-03-03 is a Tuesday.
+	tuesday := time.Date(2026, 3, 3, 3, 0, 0, 0, time.UTC)
+	if reason, ok := m.Reason(web, tuesday); !ok || reason != "maintenance 'deploys'" {
+		t.Errorf("Expected web to be in the deploys window, got %q %v", reason, ok)
+	}
+	if _, ok := m.Reason(web, tuesday.Add(2*time.Hour)); ok {
+		t.Errorf("Expected web to be out of maintenance after the window")
+	}
+	if _, ok := m.Reason(db, tuesday); ok {
+		t.Errorf("Expected db to be out of the deploys window's scope")
+	}
+	if _, ok := m.Reason(db, time.Date(2026, 3, 6, 1, 0, 0, 0, time.UTC)); !ok {
+		t.Errorf("Expected db to be in the migration window")
+	}
+
+	silence, err := m.AddSilence(Silence{MaintenanceScope: MaintenanceScope{Checks: []string{"db"}}, Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Expected silence to be added, got: %s", err)
+	}
+	if reason, ok := m.Reason(db, time.Now()); !ok || reason != "silence "+silence.ID {
+		t.Errorf("Expected db to be silenced, got %q %v", reason, ok)
+	}
+	if _, ok := m.Reason(web, time.Now()); ok {
+		t.Errorf("Expected web to be out of the silence's scope")
+	}
+	if err := m.ExpireSilence(silence.ID); err != nil {
+		t.Errorf("Expected silence to expire, got: %s", err)
+	}
+	if _, ok := m.Reason(db, time.Now()); ok {
+		t.Errorf("Expected db to be out of maintenance once the silence expired")
+	}
+	if err := m.ExpireSilence(silence.ID); err == nil {
+		t.Errorf("Expected expiring an unknown silence to fail")
+	}
+}
+
+func TestMaintenanceAddSilence(t *testing.T) {
+	now := time.Now()
+	silenceTests := []struct {
+		name    string
+		silence Silence
+		succeed bool
+	}{
+		{"scoped", Silence{MaintenanceScope: MaintenanceScope{Tags: []string{"eu"}}, Expires: now.Add(time.Hour)}, true},
+		{"all", Silence{All: true, Expires: now.Add(time.Hour)}, true},
+		{"no scope", Silence{Expires: now.Add(time.Hour)}, false},
+		{"expired", Silence{All: true, Expires: now.Add(-time.Minute)}, false},
+		{"expires before start", Silence{All: true, Start: now.Add(2 * time.Hour), Expires: now.Add(time.Hour)}, false},
+	}
+
+	for _, tt := range silenceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			silence, err := NewMaintenance().AddSilence(tt.silence)
+			if tt.succeed && (err != nil || silence.ID == "" || silence.Start.IsZero()) {
+				t.Errorf("Expected %+v to succeed, got %+v: %v", tt.silence, silence, err)
+			} else if !tt.succeed && err == nil {
+				t.Errorf("Expected %+v to fail", tt.silence)
+			}
+		})
+	}
+}
+
+func TestMaintenanceLoadSilences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "silences")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "silences.json")
+
+	m := NewMaintenance()
+	if err := m.LoadSilences(path); err != nil {
+		t.Fatalf("Expected a missing file to load no silences, got: %s", err)
+	}
+	silence, err := m.AddSilence(Silence{All: true, Comment: "deploy", Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewMaintenance()
+	if err := loaded.LoadSilences(path); err != nil {
+		t.Fatalf("Expected silences to load, got: %s", err)
+	}
+	silences := loaded.Silences()
+	if len(silences) != 1 || silences[0].ID != silence.ID || silences[0].Comment != "deploy" {
+		t.Errorf("Expected the saved silence, got: %+v", silences)
+	}
+
+	ioutil.WriteFile(path, []byte("not json"), 0640)
+	if err := NewMaintenance().LoadSilences(path); err == nil {
+		t.Errorf("Expected invalid silences to fail loading")
+	}
+}
+
+func TestHealthCheckRunInMaintenance(t *testing.T) {
+	registry := NewRegistry()
+	registry.CheckConstructors["fail"] = func(args map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result {
+			return &Result{Timestamp: time.Now(), Result: Failure}
+		}, nil
+	}
+	registry.History = NewMemoryHistory(time.Hour)
+	target := &recordingSink{}
+	chk, err := registry.AddCheck("db", "fail", map[string]string{}, 5, []Emitter{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Maintenance.AddSilence(Silence{All: true, Expires: time.Now().Add(time.Hour)})
+
+	chk.Run(context.Background())
+	results := target.Results()
+	if len(results) != 1 || !results[0].Maintenance {
+		t.Fatalf("Expected the result to be flagged as in maintenance, got: %+v", results)
+	}
+	entries, _ := registry.History.Entries("db", time.Now().Add(-time.Minute), time.Time{})
+	if len(entries) != 1 || !entries[0].Maintenance {
+		t.Errorf("Expected the history entry to be flagged as in maintenance, got: %+v", entries)
+	}
+}
@@ -1,10 +1,17 @@
 package healthchecker
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
 	"os"
+	"regexp"
+	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/net/icmp"
@@ -21,6 +28,7 @@ const (
 	idMaxrange  = 32000
 	echoSeq     = 1
 	echoReqCode = 0
+	tcpBufSize  = 4096
 )
 
 type ICMPPacketConn interface {
@@ -39,6 +47,29 @@ type ICMPChecker struct {
 	Conn      ICMPPacketConn
 	checkerId int
 	timeout   time.Duration
+	// connFree holds a token while no check uses Conn, so the checks sharing
+	// it take turns and each sets its deadline.
+	connOnce sync.Once
+	connFree chan struct{}
+}
+
+// acquireConn waits for Conn to be free until ctx is done, and reports
+// whether the check got it.
+func (i *ICMPChecker) acquireConn(ctx context.Context) bool {
+	i.connOnce.Do(func() {
+		i.connFree = make(chan struct{}, 1)
+		i.connFree <- struct{}{}
+	})
+	select {
+	case <-i.connFree:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (i *ICMPChecker) releaseConn() {
+	i.connFree <- struct{}{}
 }
 
 func NewICMPChecker(timeout time.Duration) (*ICMPChecker, error) {
@@ -94,31 +125,44 @@ func (i *ICMPChecker) sendICMPV4Echo(targetIP *net.IPAddr, ua []byte) (*icmp.Mes
 	return resp, nil
 }
 
-func (i *ICMPChecker) ICMPV4Check(targetIP *net.IPAddr) *Result {
-	i.Conn.SetDeadline(time.Now().Add(i.timeout))
+func (i *ICMPChecker) ICMPV4Check(ctx context.Context, targetIP *net.IPAddr) *Result {
+	ctx, cancel := withDefaultTimeout(ctx, i.timeout)
+	defer cancel()
+	// Cancelling through the deadline of the shared conn would fail the
+	// checks waiting for it as well, so a check only stops at its deadline.
+	waitStart := time.Now()
+	if !i.acquireConn(ctx) {
+		res := &Result{Timestamp: waitStart, Duration: time.Since(waitStart)}
+		res.Fail(Error, CategoryTimeout, "waited %s for the ICMP conn used by other checks",
+			res.Duration.Round(time.Millisecond))
+		return res
+	}
+	defer i.releaseConn()
+	i.Conn.SetDeadline(contextDeadline(ctx))
 	timeStart := time.Now()
 	log.Debugf("Running ICMP4 on target: %v", targetIP)
 	resp, err := i.sendICMPV4Echo(targetIP, []byte("sirmackk/healthchecker"))
-	if err != nil || resp.Type != ipv4.ICMPTypeEchoReply {
-		log.Debugf("ICMP4 failed on either err (%v)", err)
-		if resp != nil {
-			log.Debugf("bad resp type: %v", resp.Type)
-		}
-		return &Result{
-			Timestamp: timeStart,
-			Result:    Failure,
-			Duration:  time.Since(timeStart),
-		}
-	}
-
-	return &Result{
+	res := &Result{
 		Timestamp: timeStart,
 		Result:    Success,
 		Duration:  time.Since(timeStart),
 	}
+	if err != nil {
+		log.Debugf("ICMP4 failed on err (%v)", err)
+		_, category := classifyNetError(err)
+		res.Fail(Failure, category, "no echo reply from %s: %s", targetIP, err)
+	} else if resp.Type != ipv4.ICMPTypeEchoReply {
+		log.Debugf("bad resp type: %v", resp.Type)
+		res.Fail(Failure, CategoryProtocol, "unexpected ICMP reply from %s: %v", targetIP, resp.Type)
+	}
+	return res
 }
 
-func (i *ICMPChecker) NewICMPV4Check(args map[string]string) (func() *Result, error) {
+var ICMPV4CheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "targetIP", Required: true, Description: "IPv4 address or hostname to ping"},
+}}
+
+func (i *ICMPChecker) NewICMPV4Check(args map[string]string) (CheckFunc, error) {
 	IP, ok := args["targetIP"]
 	if !ok {
 		return nil, fmt.Errorf("ICMPV4Check missing 'targetIP' parameter")
@@ -127,7 +171,159 @@ func (i *ICMPChecker) NewICMPV4Check(args map[string]string) (func() *Result, er
 	if err != nil {
 		return nil, fmt.Errorf("Unable to parse %s into ipv4 address: %s", IP, err)
 	}
-	return func() *Result {
-		return i.ICMPV4Check(targetIP)
+	return func(ctx context.Context) *Result {
+		return i.ICMPV4Check(ctx, targetIP)
+	}, nil
+}
+
+type TCPChecker struct {
+	Dialer  *net.Dialer
+	Timeout time.Duration
+}
+
+func NewTCPChecker(timeout time.Duration) *TCPChecker {
+	checker := TCPChecker{
+		Dialer:  &net.Dialer{},
+		Timeout: timeout,
+	}
+	return &checker
+}
+
+// withDefaultTimeout bounds ctx by the checker-wide timeout unless the
+// caller already set a deadline, so per-check timeouts take precedence.
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextDeadline returns the deadline of ctx, or the zero time if it has none.
+func contextDeadline(ctx context.Context) time.Time {
+	deadline, _ := ctx.Deadline()
+	return deadline
+}
+
+// cancelOnDone unblocks pending reads and writes on conn once ctx is
+// cancelled. The returned func releases the watcher and must be called once
+// the check is done with conn.
+func cancelOnDone(ctx context.Context, conn interface{ SetDeadline(time.Time) error }) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// classifyNetError maps timeouts to Failure and everything else that kept
+// the check from completing to Error.
+func classifyNetError(err error) (ResultCode, ErrorCategory) {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return Failure, CategoryTimeout
+	case errors.As(err, &dnsErr):
+		return Error, CategoryDNS
+	case errors.As(err, &hostnameErr), errors.As(err, &authorityErr),
+		errors.As(err, &invalidErr), errors.As(err, &recordErr):
+		return Error, CategoryTLS
+	default:
+		return Error, CategoryConnection
+	}
+}
+
+func (t *TCPChecker) exchangeBanner(ctx context.Context, conn net.Conn, res *Result, sendString string, rex *regexp.Regexp) {
+	conn.SetDeadline(contextDeadline(ctx))
+	defer cancelOnDone(ctx, conn)()
+	if sendString != "" {
+		if _, err := conn.Write([]byte(sendString)); err != nil {
+			log.Debugf("TCPConnectCheck to %s couldn't write: %v", conn.RemoteAddr(), err)
+			code, category := classifyNetError(err)
+			res.Fail(code, category, "couldn't send to %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+	if rex == nil {
+		return
+	}
+	buf := make([]byte, tcpBufSize)
+	bytesRead := 0
+	defer func() { res.SetMetric("bytes_read", float64(bytesRead)) }()
+	for bytesRead < len(buf) {
+		n, err := conn.Read(buf[bytesRead:])
+		bytesRead += n
+		if rex.Match(buf[:bytesRead]) {
+			return
+		}
+		if err != nil {
+			log.Debugf("TCPConnectCheck to %s stopped reading: %v - %q", conn.RemoteAddr(), err, buf[:bytesRead])
+			if _, ok := err.(net.Error); ok {
+				code, category := classifyNetError(err)
+				res.Fail(code, category, "no banner matching %q from %s: %s", rex, conn.RemoteAddr(), err)
+				return
+			}
+			break
+		}
+	}
+	res.Fail(Failure, CategoryContent, "banner from %s did not match %q", conn.RemoteAddr(), rex)
+}
+
+func (t *TCPChecker) TCPConnectCheck(ctx context.Context, addr, sendString string, rex *regexp.Regexp) *Result {
+	ctx, cancel := withDefaultTimeout(ctx, t.Timeout)
+	defer cancel()
+	timeStart := time.Now()
+	conn, err := t.Dialer.DialContext(ctx, "tcp", addr)
+	res := &Result{
+		Timestamp: timeStart,
+		Result:    Success,
+		Duration:  time.Since(timeStart),
+	}
+	if err != nil {
+		log.Debugf("TCPConnectCheck to %s failed: %v", addr, err)
+		code, category := classifyNetError(err)
+		res.Fail(code, category, "%s", err)
+		return res
+	}
+	defer conn.Close()
+	t.exchangeBanner(ctx, conn, res, sendString, rex)
+	return res
+}
+
+var TCPConnectCheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "host", Required: true, Description: "host to connect to"},
+	{Name: "port", Type: ArgPort, Required: true, Description: "port to connect to"},
+	{Name: "sendString", Description: "string to send after connecting"},
+	{Name: "expectRegexp", Type: ArgRegexp, Description: "regexp the banner or reply must match"},
+}}
+
+func (t *TCPChecker) NewTCPConnectCheck(args map[string]string) (CheckFunc, error) {
+	host, ok := args["host"]
+	if !ok {
+		return nil, fmt.Errorf("TCPConnectCheck missing 'host' parameter")
+	}
+	port, err := TCPConnectCheckArgs.Int(args, "port")
+	if err != nil {
+		return nil, fmt.Errorf("TCPConnectCheck %s", err)
+	}
+	var expectRegexp *regexp.Regexp
+	if expectArg, ok := args["expectRegexp"]; ok {
+		expectRegexp, err = regexp.Compile(expectArg)
+		if err != nil {
+			return nil, fmt.Errorf("TCPConnectCheck 'expectRegexp' is not a valid regexp: %s", err)
+		}
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	sendString := args["sendString"]
+	return func(ctx context.Context) *Result {
+		return t.TCPConnectCheck(ctx, addr, sendString, expectRegexp)
 	}, nil
 }
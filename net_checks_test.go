@@ -1,7 +1,12 @@
 package healthchecker
 
 import (
+	"bufio"
+	"context"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -60,7 +65,7 @@ func TestICMPV4Check(t *testing.T) {
 	}
 
 	for _, tt := range OutputMsgs {
-		t.Run(string(tt.result), func(t *testing.T) {
+		t.Run(tt.result.String(), func(t *testing.T) {
 			fakePktConn := NewFakePacketConn()
 			fakePktConn.(*fakePacketConn).OutputBuf = tt.outbuf
 			checker := &ICMPChecker{
@@ -68,7 +73,7 @@ func TestICMPV4Check(t *testing.T) {
 			}
 
 			checkFunc, _ := checker.NewICMPV4Check(map[string]string{"targetIP": "localhost"})
-			res := checkFunc()
+			res := checkFunc(context.Background())
 
 			if res.Result != tt.result {
 				t.Errorf(
@@ -81,3 +86,186 @@ func TestICMPV4Check(t *testing.T) {
 		})
 	}
 }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// slowPacketConn replies after delay unless its deadline passes first.
+type slowPacketConn struct {
+	fakePacketConn
+	delay    time.Duration
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (s *slowPacketConn) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	return nil
+}
+
+func (s *slowPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		return 0, nil, timeoutError{}
+	}
+	return s.fakePacketConn.ReadFrom(p)
+}
+
+func TestICMPV4CheckSharedConn(t *testing.T) {
+	conn := &slowPacketConn{delay: 50 * time.Millisecond}
+	conn.InputBuf = make([]byte, 32)
+	conn.OutputBuf = []byte{0x0, 0x0, 0xb7, 0xd2, 0x3, 0xe9, 0x0, 0x1, 0x70, 0x69, 0x6e, 0x67, 0x65, 0x72}
+	checker := &ICMPChecker{Conn: conn, timeout: time.Second}
+	checkFunc, _ := checker.NewICMPV4Check(map[string]string{"targetIP": "localhost"})
+
+	// Cancelling one check must not cut short the others using the conn.
+	cancelled, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		checkFunc(cancelled)
+	}()
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if res := checkFunc(context.Background()); res.Result != Success {
+		t.Errorf("Expected a Success, got %s: %s", res.Result, res.Message)
+	}
+	wg.Wait()
+
+	// A check whose time runs out while waiting for the conn says so.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		checkFunc(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	waiting, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	res := checkFunc(waiting)
+	if res.Result != Error || res.Category != CategoryTimeout || !strings.HasPrefix(res.Message, "waited ") || !strings.Contains(res.Message, "for the ICMP conn") {
+		t.Errorf("Expected a timeout waiting for the conn, got %s [%s] %s", res.Result, res.Category, res.Message)
+	}
+	wg.Wait()
+}
+
+func startTCPServer(t *testing.T, handler func(net.Conn)) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't start tcp listener: %s", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+func closedTCPPort(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't start tcp listener: %s", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	return port
+}
+
+func TestTCPConnectCheck(t *testing.T) {
+	ln := startTCPServer(t, func(conn net.Conn) {
+		conn.Write([]byte("220 smtp.example.com ESMTP\r\n"))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		if line == "PING\n" {
+			conn.Write([]byte("PONG\n"))
+		}
+	})
+	defer ln.Close()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	tcpTests := []struct {
+		name   string
+		args   map[string]string
+		result ResultCode
+	}{
+		{"connect", map[string]string{"host": host, "port": port}, Success},
+		{"banner match", map[string]string{"host": host, "port": port, "expectRegexp": "^220 .*ESMTP"}, Success},
+		{"banner mismatch", map[string]string{"host": host, "port": port, "expectRegexp": "^554"}, Failure},
+		{"send and expect", map[string]string{"host": host, "port": port, "sendString": "PING\n", "expectRegexp": "PONG"}, Success},
+		{"refused", map[string]string{"host": host, "port": closedTCPPort(t)}, Error},
+	}
+
+	checker := NewTCPChecker(500 * time.Millisecond)
+	for _, tt := range tcpTests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkFunc, err := checker.NewTCPConnectCheck(tt.args)
+			if err != nil {
+				t.Fatalf("Couldn't create check: %s", err)
+			}
+			res := checkFunc(context.Background())
+			if res.Result != tt.result {
+				t.Errorf("Got: %s, Wanted: %s", res.Result, tt.result)
+			}
+		})
+	}
+}
+
+func TestTCPConnectCheckTimeout(t *testing.T) {
+	ln := startTCPServer(t, func(conn net.Conn) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	defer ln.Close()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	checker := NewTCPChecker(100 * time.Millisecond)
+	checkFunc, _ := checker.NewTCPConnectCheck(map[string]string{
+		"host":         host,
+		"port":         port,
+		"expectRegexp": "never sent",
+	})
+	res := checkFunc(context.Background())
+	if res.Result != Failure {
+		t.Errorf("Expected Failure on banner timeout, got: %s", res.Result)
+	}
+}
+
+func TestNewTCPConnectCheckArgs(t *testing.T) {
+	argTests := []struct {
+		name    string
+		args    map[string]string
+		succeed bool
+	}{
+		{"no host", map[string]string{"port": "25"}, false},
+		{"no port", map[string]string{"host": "localhost"}, false},
+		{"bad port", map[string]string{"host": "localhost", "port": "smtp"}, false},
+		{"port out of range", map[string]string{"host": "localhost", "port": strconv.Itoa(70000)}, false},
+		{"bad regexp", map[string]string{"host": "localhost", "port": "25", "expectRegexp": "(unclosed"}, false},
+		{"alright", map[string]string{"host": "localhost", "port": "25", "expectRegexp": "^220"}, true},
+	}
+
+	checker := NewTCPChecker(time.Second)
+	for _, tt := range argTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checker.NewTCPConnectCheck(tt.args)
+			if !tt.succeed && err == nil {
+				t.Errorf("Got %#v, expected to fail but succeeded", tt.args)
+			}
+			if tt.succeed && err != nil {
+				t.Errorf("Got %#v, expected to succeed but failed: %s", tt.args, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package healthchecker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPrometheusPath   = "/metrics"
+	prometheusNamespace     = "healthcheck"
+	prometheusCloseDeadline = 5 * time.Second
+)
+
+// PrometheusSink serves the latest results of every check emitting to it on
+// an HTTP endpoint for Prometheus to scrape. Give it an 'id' to share one
+// endpoint between all checks.
+type PrometheusSink struct {
+	Registry     *prometheus.Registry
+	server       *http.Server
+	listener     net.Listener
+	lastResult   *prometheus.GaugeVec
+	lastDuration *prometheus.GaugeVec
+	duration     *prometheus.HistogramVec
+	results      *prometheus.CounterVec
+}
+
+func parseBuckets(arg string) ([]float64, error) {
+	buckets := make([]float64, 0)
+	for _, bucket := range strings.Split(arg, ",") {
+		val, err := strconv.ParseFloat(strings.TrimSpace(bucket), 64)
+		if err != nil {
+			return nil, fmt.Errorf("'buckets' must be a comma separated list of seconds, got: %s", arg)
+		}
+		buckets = append(buckets, val)
+	}
+	return buckets, nil
+}
+
+var PrometheusSinkArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "addr", Required: true, Description: "host:port to serve metrics on"},
+	{Name: "path", Default: defaultPrometheusPath, Description: "path to serve metrics on"},
+	{Name: "buckets", Type: ArgFloatList, Description: "comma separated duration histogram buckets in seconds"},
+}}
+
+func NewPrometheusSink(args map[string]string) (Emitter, error) {
+	errPrefix := "Error creating PrometheusSink -"
+	addr, ok := args["addr"]
+	if !ok {
+		return nil, fmt.Errorf("%s addr parameter missing", errPrefix)
+	}
+	path, _ := PrometheusSinkArgs.Lookup(args, "path")
+	buckets := prometheus.DefBuckets
+	if bucketsArg, ok := args["buckets"]; ok {
+		var err error
+		if buckets, err = parseBuckets(bucketsArg); err != nil {
+			return nil, fmt.Errorf("%s %s", errPrefix, err)
+		}
+	}
+
+	labels := []string{"name", "type"}
+	sink := &PrometheusSink{
+		Registry: prometheus.NewRegistry(),
+		lastResult: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "last_result",
+			Help:      "Result code of the latest check run: 0 success, 1 failure, 2 error, 3 upstream down.",
+		}, labels),
+		lastDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      "last_duration_seconds",
+			Help:      "Duration of the latest check run.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "duration_seconds",
+			Help:      "Duration of check runs.",
+			Buckets:   buckets,
+		}, labels),
+		results: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "results_total",
+			Help:      "Number of check runs by result.",
+		}, append(labels, "result")),
+	}
+	sink.Registry.MustRegister(sink.lastResult, sink.lastDuration, sink.duration, sink.results)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s cannot listen on %s: %s", errPrefix, addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(sink.Registry, promhttp.HandlerOpts{}))
+	sink.listener = listener
+	sink.server = &http.Server{Handler: mux}
+	go func() {
+		if err := sink.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("PrometheusSink stopped serving: %s", err)
+		}
+	}()
+	return sink, nil
+}
+
+func (p *PrometheusSink) Emit(name, checkType string, c *Result, s *CheckState) {
+	seconds := c.Duration.Seconds()
+	p.lastResult.WithLabelValues(name, checkType).Set(float64(c.Result))
+	p.lastDuration.WithLabelValues(name, checkType).Set(seconds)
+	p.duration.WithLabelValues(name, checkType).Observe(seconds)
+	p.results.WithLabelValues(name, checkType, strings.ToLower(c.Result.String())).Inc()
+}
+
+func (p *PrometheusSink) Name() string {
+	return "PrometheusSink"
+}
+
+// Addr is the address the metrics endpoint is listening on.
+func (p *PrometheusSink) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+func (p *PrometheusSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), prometheusCloseDeadline)
+	defer cancel()
+	return p.server.Shutdown(ctx)
+}
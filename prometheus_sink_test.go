@@ -0,0 +1,73 @@
+package healthchecker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusSinkMetrics(t *testing.T) {
+	sink, err := NewPrometheusSink(map[string]string{"addr": "127.0.0.1:0", "buckets": "0.1, 0.5, 1"})
+	if err != nil {
+		t.Fatalf("Couldn't create PrometheusSink: %s", err)
+	}
+	promSink := sink.(*PrometheusSink)
+	defer promSink.Close()
+
+	now := time.Now()
+	sink.Emit("blog", "SimpleHTTPCheck", &Result{Timestamp: now, Result: Success, Duration: 200 * time.Millisecond}, nil)
+	sink.Emit("blog", "SimpleHTTPCheck", &Result{Timestamp: now, Result: Failure, Duration: 700 * time.Millisecond}, nil)
+	sink.Emit("router", "ICMPV4Check", &Result{Timestamp: now, Result: Error, Duration: 50 * time.Millisecond}, nil)
+
+	resp, err := http.Get("http://" + promSink.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("Couldn't scrape metrics: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	expected := []string{
+		`healthcheck_last_result{name="blog",type="SimpleHTTPCheck"} 1`,
+		`healthcheck_last_duration_seconds{name="blog",type="SimpleHTTPCheck"} 0.7`,
+		`healthcheck_duration_seconds_bucket{name="blog",type="SimpleHTTPCheck",le="0.5"} 1`,
+		`healthcheck_duration_seconds_count{name="blog",type="SimpleHTTPCheck"} 2`,
+		`healthcheck_results_total{name="blog",result="success",type="SimpleHTTPCheck"} 1`,
+		`healthcheck_results_total{name="blog",result="failure",type="SimpleHTTPCheck"} 1`,
+		`healthcheck_results_total{name="router",result="error",type="ICMPV4Check"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("Missing metric line: %s", line)
+		}
+	}
+}
+
+func TestNewPrometheusSink(t *testing.T) {
+	newSinkTests := []struct {
+		name    string
+		args    map[string]string
+		succeed bool
+	}{
+		{"no addr", map[string]string{"path": "/metrics"}, false},
+		{"bad addr", map[string]string{"addr": "not an address"}, false},
+		{"bad buckets", map[string]string{"addr": "127.0.0.1:0", "buckets": "0.1,fast"}, false},
+		{"alright", map[string]string{"addr": "127.0.0.1:0", "path": "/prom"}, true},
+	}
+
+	for _, tt := range newSinkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := NewPrometheusSink(tt.args)
+			if !tt.succeed && err == nil {
+				t.Errorf("Got %#v, expected to fail but succeeded", tt.args)
+			}
+			if tt.succeed && err != nil {
+				t.Errorf("Got %#v, expected to succeed but failed: %s", tt.args, err)
+			}
+			if sink != nil {
+				sink.(*PrometheusSink).Close()
+			}
+		})
+	}
+}
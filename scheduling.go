@@ -0,0 +1,402 @@
+package healthchecker
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"time"
+
+	cron "gopkg.in/robfig/cron.v3"
+)
+
+const (
+	// Interval given to checks whose schedule never runs again.
+	neverInterval = hoursInDay * time.Hour
+	// How many window and schedule steps WindowedSchedule.Next takes looking
+	// for a run inside an active window before giving up.
+	maxWindowSearch = 1000
+)
+
+// Schedule decides when a check runs.
+type Schedule interface {
+	// Next returns the first time after t the check should run, or the zero
+	// time if it never runs again.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// IntervalSchedule runs a check every Interval.
+type IntervalSchedule struct {
+	Interval time.Duration
+}
+
+func (s IntervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.Interval)
+}
+
+func (s IntervalSchedule) String() string {
+	return fmt.Sprintf("every %s", s.Interval)
+}
+
+// CronSchedule runs a check at the times matching a standard five field cron
+// expression, or a descriptor like @daily, in Location.
+type CronSchedule struct {
+	Expression string
+	Location   *time.Location
+	schedule   cron.Schedule
+}
+
+func NewCronSchedule(expression string, location *time.Location) (*CronSchedule, error) {
+	if location == nil {
+		location = time.Local
+	}
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression '%s': %s", expression, err)
+	}
+	return &CronSchedule{Expression: expression, Location: location, schedule: schedule}, nil
+}
+
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t.In(s.Location))
+}
+
+func (s *CronSchedule) String() string {
+	return fmt.Sprintf("cron '%s' (%s)", s.Expression, s.Location)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ActiveWindow is a daily period, from Start to End after midnight, on the
+// given Days. A window ending before it starts runs past midnight into the
+// next day.
+type ActiveWindow struct {
+	Days  [7]bool
+	Start time.Duration
+	End   time.Duration
+	spec  string
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s', use HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseDays(value string) ([7]bool, error) {
+	var days [7]bool
+	for _, item := range strings.Split(strings.ToLower(value), ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		first, ok := weekdays[bounds[0]]
+		last := first
+		if ok && len(bounds) == 2 {
+			last, ok = weekdays[bounds[1]]
+		}
+		if !ok {
+			return days, fmt.Errorf("invalid days '%s', use eg. Mon-Fri or Sat,Sun", value)
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// ParseActiveWindow parses windows like "Mon-Fri 09:00-17:00", "Sat,Sun
+// 10:00-14:00" or "22:00-06:00" for every day.
+func ParseActiveWindow(value string) (ActiveWindow, error) {
+	window := ActiveWindow{spec: value}
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+		window.Days = [7]bool{true, true, true, true, true, true, true}
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return window, err
+		}
+		window.Days = days
+	default:
+		return window, fmt.Errorf("invalid active window '%s', use eg. Mon-Fri 09:00-17:00", value)
+	}
+	bounds := strings.SplitN(fields[len(fields)-1], "-", 2)
+	if len(bounds) != 2 {
+		return window, fmt.Errorf("invalid active window '%s', use eg. Mon-Fri 09:00-17:00", value)
+	}
+	var err error
+	if window.Start, err = parseTimeOfDay(bounds[0]); err != nil {
+		return window, err
+	}
+	if window.End, err = parseTimeOfDay(bounds[1]); err != nil {
+		return window, err
+	}
+	if window.Start == window.End {
+		return window, fmt.Errorf("active window '%s' is empty", value)
+	}
+	return window, nil
+}
+
+func (w ActiveWindow) String() string {
+	return w.spec
+}
+
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+// Active reports whether local, a time in the window's location, is inside
+// the window.
+func (w ActiveWindow) Active(local time.Time) bool {
+	day, tod := local.Weekday(), timeOfDay(local)
+	if w.Start < w.End {
+		return w.Days[day] && tod >= w.Start && tod < w.End
+	}
+	return (w.Days[day] && tod >= w.Start) || (w.Days[(day+6)%7] && tod < w.End)
+}
+
+// nextStart is the first time after local the window opens.
+func (w ActiveWindow) nextStart(local time.Time) time.Time {
+	for days := 0; days <= 7; days++ {
+		day := local.AddDate(0, 0, days)
+		if !w.Days[day.Weekday()] {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, local.Location()).Add(w.Start)
+		if start.After(local) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// WindowedSchedule only runs a check when Schedule and one of Windows agree.
+// A check on an interval runs as soon as a window opens.
+type WindowedSchedule struct {
+	Schedule Schedule
+	Windows  []ActiveWindow
+	Location *time.Location
+}
+
+// Active reports whether t is inside any of the windows.
+func (s *WindowedSchedule) Active(t time.Time) bool {
+	local := t.In(s.Location)
+	for _, window := range s.Windows {
+		if window.Active(local) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *WindowedSchedule) nextStart(t time.Time) time.Time {
+	local := t.In(s.Location)
+	var next time.Time
+	for _, window := range s.Windows {
+		start := window.nextStart(local)
+		if !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
+
+func (s *WindowedSchedule) Next(t time.Time) time.Time {
+	_, onInterval := s.Schedule.(IntervalSchedule)
+	next := s.Schedule.Next(t)
+	for i := 0; i < maxWindowSearch && !next.IsZero(); i++ {
+		if s.Active(next) {
+			return next
+		}
+		start := s.nextStart(next)
+		if onInterval || start.IsZero() {
+			return start
+		}
+		next = s.Schedule.Next(start.Add(-time.Nanosecond))
+	}
+	return time.Time{}
+}
+
+func (s *WindowedSchedule) String() string {
+	windows := make([]string, len(s.Windows))
+	for i, window := range s.Windows {
+		windows[i] = window.String()
+	}
+	return fmt.Sprintf("%s during %s (%s)", s.Schedule, strings.Join(windows, ", "), s.Location)
+}
+
+// ScheduleFromConfig creates the schedule of a check: its cron schedule if
+// set, its interval otherwise, limited to its active windows.
+func ScheduleFromConfig(conf HealthChecksConfig) (Schedule, error) {
+	location := time.Local
+	if conf.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(conf.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone '%s': %s", conf.Timezone, err)
+		}
+	}
+	var schedule Schedule = IntervalSchedule{Interval: time.Duration(conf.Interval) * time.Second}
+	if conf.Schedule != "" {
+		cronSchedule, err := NewCronSchedule(conf.Schedule, location)
+		if err != nil {
+			return nil, err
+		}
+		schedule = cronSchedule
+	}
+	if len(conf.ActiveWindows) == 0 {
+		return schedule, nil
+	}
+	windowed := &WindowedSchedule{Schedule: schedule, Location: location}
+	for _, spec := range conf.ActiveWindows {
+		window, err := ParseActiveWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		windowed.Windows = append(windowed.Windows, window)
+	}
+	return windowed, nil
+}
+
+// ScheduleInterval is the time between runs of schedule, for schedules that
+// aren't on an interval the gap between their next two runs after now.
+func ScheduleInterval(schedule Schedule, now time.Time) time.Duration {
+	if windowed, ok := schedule.(*WindowedSchedule); ok {
+		schedule = windowed.Schedule
+	}
+	if interval, ok := schedule.(IntervalSchedule); ok {
+		return interval.Interval
+	}
+	first := schedule.Next(now)
+	second := schedule.Next(first)
+	if first.IsZero() || second.IsZero() {
+		return neverInterval
+	}
+	return second.Sub(first)
+}
+
+// onInterval reports whether the check runs on an interval, which is the
+// only kind of schedule splay applies to.
+func (h *HealthCheck) onInterval() bool {
+	schedule := h.Schedule
+	if windowed, ok := schedule.(*WindowedSchedule); ok {
+		schedule = windowed.Schedule
+	}
+	_, ok := schedule.(IntervalSchedule)
+	return ok
+}
+
+// firstRun is when the check, started at now, first runs. Checks on an
+// interval run right away or after their splay, others at their next
+// scheduled time.
+func (h *HealthCheck) firstRun(now time.Time) time.Time {
+	if !h.onInterval() {
+		return h.Schedule.Next(now)
+	}
+	first := now.Add(h.firstRunDelay(now))
+	if windowed, ok := h.Schedule.(*WindowedSchedule); ok && !windowed.Active(first) {
+		return windowed.Next(first)
+	}
+	return first
+}
+
+// nextRun is when the check runs after the run scheduled at last, skipping
+// runs that were missed by now.
+func (h *HealthCheck) nextRun(last, now time.Time) time.Time {
+	next := h.Schedule.Next(last)
+	if !next.IsZero() && next.Before(now) {
+		next = h.Schedule.Next(now)
+	}
+	return next
+}
+
+// SplayMode decides when a check on an interval first runs after it's
+// started.
+type SplayMode string
+
+const (
+	// SplayNone runs the check right away.
+	SplayNone SplayMode = "none"
+	// SplayRandom delays the first run by a random part of the interval.
+	SplayRandom SplayMode = "random"
+	// SplayHash runs the check at a fixed offset into every interval derived
+	// from its name, so it keeps the same phase across restarts.
+	SplayHash SplayMode = "hash"
+)
+
+// ParseSplayMode parses a splay mode, an empty value is SplayNone.
+func ParseSplayMode(value string) (SplayMode, error) {
+	switch mode := SplayMode(value); mode {
+	case "":
+		return SplayNone, nil
+	case SplayNone, SplayRandom, SplayHash:
+		return mode, nil
+	default:
+		return SplayNone, fmt.Errorf("splay must be one of none, random or hash, got: %s", value)
+	}
+}
+
+// hashOffset is the check's fixed offset into its interval for SplayHash.
+func (h *HealthCheck) hashOffset() time.Duration {
+	hash := fnv.New64a()
+	hash.Write([]byte(h.Name))
+	return time.Duration(hash.Sum64() % uint64(h.Interval))
+}
+
+// firstRunDelay is how long after now the check should first run.
+func (h *HealthCheck) firstRunDelay(now time.Time) time.Duration {
+	if h.Interval <= 0 {
+		return 0
+	}
+	switch h.Splay {
+	case SplayRandom:
+		return time.Duration(rand.Int63n(int64(h.Interval)))
+	case SplayHash:
+		// Align to the wall clock so the phase doesn't depend on when the
+		// check was started.
+		phase := time.Duration(now.UnixNano() % int64(h.Interval))
+		delay := h.hashOffset() - phase
+		if delay < 0 {
+			delay += h.Interval
+		}
+		return delay
+	default:
+		return 0
+	}
+}
+
+// jitter is a random delay of up to Jitter added before every run.
+func (h *HealthCheck) jitter() time.Duration {
+	jitter := h.Jitter
+	if h.Interval > 0 && jitter > h.Interval {
+		jitter = h.Interval
+	}
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// sleep waits for d, returning false if ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,254 @@
+package healthchecker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseSplayMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		mode    SplayMode
+		succeed bool
+	}{
+		{"", SplayNone, true},
+		{"none", SplayNone, true},
+		{"random", SplayRandom, true},
+		{"hash", SplayHash, true},
+		{"sometimes", SplayNone, false},
+	}
+	for _, test := range tests {
+		mode, err := ParseSplayMode(test.value)
+		if (err == nil) != test.succeed || mode != test.mode {
+			t.Errorf("ParseSplayMode(%q) = %s, %v", test.value, mode, err)
+		}
+	}
+}
+
+func TestFirstRunDelay(t *testing.T) {
+	chk := &HealthCheck{Name: "web", Interval: time.Minute}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if delay := chk.firstRunDelay(now); delay != 0 {
+		t.Errorf("Expected no delay without splay, got %s", delay)
+	}
+
+	chk.Splay = SplayRandom
+	for i := 0; i < 100; i++ {
+		if delay := chk.firstRunDelay(now); delay < 0 || delay >= time.Minute {
+			t.Fatalf("Random splay outside of the interval: %s", delay)
+		}
+	}
+
+	// A hashed check runs at the same offset into the interval no matter
+	// when it's started.
+	chk.Splay = SplayHash
+	offset := chk.hashOffset()
+	for _, started := range []time.Duration{0, 7 * time.Second, 59 * time.Second, time.Hour + 30*time.Second} {
+		firstRun := now.Add(started).Add(chk.firstRunDelay(now.Add(started)))
+		if phase := time.Duration(firstRun.UnixNano() % int64(time.Minute)); phase != offset {
+			t.Errorf("Started at +%s, expected phase %s, got %s", started, offset, phase)
+		}
+		if firstRun.Sub(now.Add(started)) >= time.Minute {
+			t.Errorf("Started at +%s, first run is more than an interval away", started)
+		}
+	}
+	other := &HealthCheck{Name: "db", Interval: time.Minute}
+	if other.hashOffset() == offset {
+		t.Errorf("Expected different checks to get different offsets")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	chk := &HealthCheck{Interval: time.Second}
+	if jitter := chk.jitter(); jitter != 0 {
+		t.Errorf("Expected no jitter by default, got %s", jitter)
+	}
+	chk.Jitter = time.Minute
+	for i := 0; i < 100; i++ {
+		if jitter := chk.jitter(); jitter < 0 || jitter >= time.Second {
+			t.Fatalf("Jitter should be capped at the interval, got %s", jitter)
+		}
+	}
+}
+
+func TestRegistrySchedulingDefaults(t *testing.T) {
+	registry := NewRegistry()
+	registry.CheckConstructors["testing"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result { return &Result{} }, nil
+	}
+	registry.Splay = SplayHash
+	registry.Jitter = 100 * time.Millisecond
+	err := registry.RegisterHealthChecks(&Config{HealthChecks: []HealthChecksConfig{
+		{Name: "default", Type: "testing", Interval: 10},
+		{Name: "own", Type: "testing", Interval: 10, Splay: "random", Jitter: 500},
+	}})
+	if err != nil {
+		t.Fatalf("Couldn't register checks: %s", err)
+	}
+	if chk := registry.Checks[0]; chk.Splay != SplayHash || chk.Jitter != 100*time.Millisecond {
+		t.Errorf("Expected registry defaults, got %s and %s", chk.Splay, chk.Jitter)
+	}
+	if chk := registry.Checks[1]; chk.Splay != SplayRandom || chk.Jitter != 500*time.Millisecond {
+		t.Errorf("Expected the check's own settings, got %s and %s", chk.Splay, chk.Jitter)
+	}
+
+	err = registry.ValidateConfig(&Config{HealthChecks: []HealthChecksConfig{
+		{Name: "bad", Type: "testing", Interval: 1, Splay: "sometimes", Jitter: 1000},
+	}})
+	if configErr, ok := err.(*ConfigError); !ok || len(configErr.Problems) != 2 {
+		t.Errorf("Expected invalid splay and jitter to be reported, got: %v", err)
+	}
+}
+
+func TestParseActiveWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		days    string
+		start   time.Duration
+		end     time.Duration
+		succeed bool
+	}{
+		{"weekdays", "Mon-Fri 09:00-17:30", "MTWTF..", 9 * time.Hour, 17*time.Hour + 30*time.Minute, true},
+		{"list", "sat,Sun 10:00-14:00", ".....SS", 10 * time.Hour, 14 * time.Hour, true},
+		{"wrapping range", "Fri-Mon 08:00-09:00", "M...FSS", 8 * time.Hour, 9 * time.Hour, true},
+		{"every day overnight", "22:00-06:00", "MTWTFSS", 22 * time.Hour, 6 * time.Hour, true},
+		{"empty", "", "", 0, 0, false},
+		{"bad day", "Someday 09:00-17:00", "", 0, 0, false},
+		{"bad time", "Mon 9-17", "", 0, 0, false},
+		{"empty window", "Mon 09:00-09:00", "", 0, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window, err := ParseActiveWindow(test.value)
+			if (err == nil) != test.succeed {
+				t.Fatalf("Expected success %t, got error: %v", test.succeed, err)
+			}
+			if !test.succeed {
+				return
+			}
+			days := ""
+			for i, letter := range "MTWTFSS" {
+				if window.Days[(i+1)%7] {
+					days += string(letter)
+				} else {
+					days += "."
+				}
+			}
+			if days != test.days || window.Start != test.start || window.End != test.end {
+				t.Errorf("Unexpected window: %s %s-%s", days, window.Start, window.End)
+			}
+		})
+	}
+}
+
+func TestCronSchedule(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Skipf("No timezone data: %s", err)
+	}
+	schedule, err := NewCronSchedule("30 2 * * *", warsaw)
+	if err != nil {
+		t.Fatalf("Couldn't parse cron expression: %s", err)
+	}
+	next := schedule.Next(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2026, 1, 2, 1, 30, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Expected %s, got %s", want, next)
+	}
+	if _, err := NewCronSchedule("every day", nil); err == nil {
+		t.Error("Expected an invalid expression to fail")
+	}
+}
+
+func TestWindowedSchedule(t *testing.T) {
+	window, _ := ParseActiveWindow("Mon-Fri 09:00-17:00")
+	// 2026-01-02 is a Friday.
+	friday := func(hour, minute int) time.Time { return time.Date(2026, 1, 2, hour, minute, 0, 0, time.UTC) }
+	monday := func(hour, minute int) time.Time { return time.Date(2026, 1, 5, hour, minute, 0, 0, time.UTC) }
+
+	interval := &WindowedSchedule{Schedule: IntervalSchedule{Interval: 10 * time.Minute}, Windows: []ActiveWindow{window}, Location: time.UTC}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		after    time.Time
+		next     time.Time
+	}{
+		{"inside window", interval, friday(10, 0), friday(10, 10)},
+		{"window closes", interval, friday(16, 55), monday(9, 0)},
+		{"before window", interval, friday(7, 0), friday(9, 0)},
+	}
+	cron, _ := NewCronSchedule("0 * * * *", time.UTC)
+	hourly := &WindowedSchedule{Schedule: cron, Windows: []ActiveWindow{window}, Location: time.UTC}
+	tests = append(tests, []struct {
+		name     string
+		schedule Schedule
+		after    time.Time
+		next     time.Time
+	}{
+		{"cron inside window", hourly, friday(10, 30), friday(11, 0)},
+		{"cron after window", hourly, friday(16, 30), monday(9, 0)},
+	}...)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if next := test.schedule.Next(test.after); !next.Equal(test.next) {
+				t.Errorf("Expected %s, got %s", test.next, next)
+			}
+		})
+	}
+
+	overnight, _ := ParseActiveWindow("Fri 22:00-06:00")
+	nights := &WindowedSchedule{Schedule: IntervalSchedule{Interval: time.Hour}, Windows: []ActiveWindow{overnight}, Location: time.UTC}
+	if !nights.Active(time.Date(2026, 1, 3, 5, 0, 0, 0, time.UTC)) || nights.Active(time.Date(2026, 1, 3, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected an overnight window to last until the next morning")
+	}
+}
+
+func TestScheduleFromConfig(t *testing.T) {
+	schedule, err := ScheduleFromConfig(HealthChecksConfig{Interval: 30})
+	if err != nil || schedule != (IntervalSchedule{Interval: 30 * time.Second}) {
+		t.Errorf("Expected an interval schedule, got %v, %v", schedule, err)
+	}
+	if ScheduleInterval(schedule, time.Now()) != 30*time.Second {
+		t.Errorf("Expected the interval of an interval schedule")
+	}
+
+	schedule, err = ScheduleFromConfig(HealthChecksConfig{Schedule: "@daily", Timezone: "UTC", ActiveWindows: []string{"Mon-Fri 00:00-01:00"}})
+	if err != nil {
+		t.Fatalf("Couldn't create schedule: %s", err)
+	}
+	if _, ok := schedule.(*WindowedSchedule); !ok {
+		t.Errorf("Expected a windowed schedule, got %s", schedule)
+	}
+	if interval := ScheduleInterval(schedule, time.Now()); interval != 24*time.Hour {
+		t.Errorf("Expected a daily schedule to be a day apart, got %s", interval)
+	}
+
+	for _, conf := range []HealthChecksConfig{
+		{Schedule: "sometimes"},
+		{Interval: 10, Timezone: "Nowhere/Special"},
+		{Interval: 10, ActiveWindows: []string{"always"}},
+	} {
+		if _, err := ScheduleFromConfig(conf); err == nil {
+			t.Errorf("Expected %+v to fail", conf)
+		}
+	}
+}
+
+func TestHealthCheckRunTimes(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 30, 0, time.UTC)
+	chk := &HealthCheck{Name: "web", Interval: time.Minute, Schedule: IntervalSchedule{Interval: time.Minute}}
+	if first := chk.firstRun(now); !first.Equal(now) {
+		t.Errorf("Expected a check on an interval to run right away, got %s", first)
+	}
+	// Runs missed while the check overran are skipped.
+	if next := chk.nextRun(now, now.Add(150*time.Second)); !next.Equal(now.Add(210 * time.Second)) {
+		t.Errorf("Expected missed runs to be skipped, got %s", next)
+	}
+
+	cron, _ := NewCronSchedule("0 * * * *", time.UTC)
+	chk.Schedule, chk.Splay = cron, SplayRandom
+	if first := chk.firstRun(now); !first.Equal(time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected a cron check to wait for its schedule, got %s", first)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	influx_client "github.com/influxdata/influxdb/client/v2"
@@ -12,7 +14,7 @@ import (
 )
 
 type Emitter interface {
-	Emit(name, checkType string, c *Result)
+	Emit(name, checkType string, c *Result, s *CheckState)
 	Name() string
 }
 
@@ -20,6 +22,10 @@ type FileSink struct {
 	TargetFile *os.File
 }
 
+var FileSinkArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "path", Required: true, Description: "absolute path of the file to append results to"},
+}}
+
 func NewFileSink(args map[string]string) (Emitter, error) {
 	errPrefix := "Error creating FileSink - "
 	path, ok := args["path"]
@@ -42,42 +48,73 @@ func NewFileSink(args map[string]string) (Emitter, error) {
 	return &FileSink{TargetFile: targetFile}, nil
 }
 
-func (f *FileSink) Emit(name, checkType string, c *Result) {
-	fmt.Fprintf(f.TargetFile, "%s [%s]: %s %s\n", c.TimestampString(), name, c.Result, c.Duration.Round(time.Millisecond))
+func (f *FileSink) Emit(name, checkType string, c *Result, s *CheckState) {
+	var details strings.Builder
+	if c.Category != CategoryNone {
+		fmt.Fprintf(&details, " [%s]", c.Category)
+	}
+	if c.Message != "" {
+		fmt.Fprintf(&details, " %s", c.Message)
+	}
+	if c.Attempts > 1 {
+		fmt.Fprintf(&details, " attempts=%d", c.Attempts)
+	}
+	if c.Maintenance {
+		details.WriteString(" maintenance")
+	}
+	metricNames := make([]string, 0, len(c.Metrics))
+	for metric := range c.Metrics {
+		metricNames = append(metricNames, metric)
+	}
+	sort.Strings(metricNames)
+	for _, metric := range metricNames {
+		fmt.Fprintf(&details, " %s=%g", metric, c.Metrics[metric])
+	}
+	if s != nil {
+		fmt.Fprintf(&details, " state=%s", s.Status)
+		if s.Changed {
+			fmt.Fprintf(&details, " (was %s)", s.Previous)
+		}
+	}
+	fmt.Fprintf(f.TargetFile, "%s [%s]: %s %s%s\n", c.TimestampString(), name, c.Result, c.Duration.Round(time.Millisecond), details.String())
 }
 
 func (f *FileSink) Name() string {
 	return "FileSink"
 }
 
+func (f *FileSink) Close() error {
+	return f.TargetFile.Close()
+}
+
 type UDPInfluxSink struct {
 	Client           influx_client.Client
 	client_config    *influx_client.UDPConfig
 	pointBox         chan *influx_client.Point
 	collectorRunning bool
+	stop             chan struct{}
+	stopped          chan struct{}
 }
 
+var UDPInfluxSinkArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "addr", Required: true, Description: "host:port of the influxdb UDP listener"},
+	{Name: "flushInterval", Type: ArgInt, Required: true, Description: "seconds between flushes"},
+	{Name: "flushCount", Type: ArgInt, Required: true, Description: "number of points that triggers a flush"},
+}}
+
 func NewUDPInfluxSink(args map[string]string) (Emitter, error) {
 	addr, ok := args["addr"]
 	if !ok {
 		return nil, fmt.Errorf("Error creating UDPInfluxSink - addr option missing")
 	}
-	flushIntervalConf, ok := args["flushInterval"]
-	if !ok {
-		return nil, fmt.Errorf("Error creating UDPInfluxSink - flushInterval missing")
-	}
-	flushIntervalVal, err := strconv.Atoi(flushIntervalConf)
+	flushIntervalVal, err := UDPInfluxSinkArgs.Int(args, "flushInterval")
 	if err != nil {
-		return nil, fmt.Errorf("Error creating UDPInfluxSink - flushInterval not valid integer")
+		return nil, fmt.Errorf("Error creating UDPInfluxSink - %s", err)
 	}
 	flushInterval := time.Duration(flushIntervalVal)
-	flushCountConf, ok := args["flushCount"]
-	if !ok {
-		return nil, fmt.Errorf("Error creating UDPInfluxSink - flushCount missing")
-	}
-	flushCount, err := strconv.Atoi(flushCountConf)
+	flushCount, err := UDPInfluxSinkArgs.Int(args, "flushCount")
 	if err != nil {
-		return nil, fmt.Errorf("Error creating UDPInfluxSink - flushCount not valid integer")
+		return nil, fmt.Errorf("Error creating UDPInfluxSink - %s", err)
 	}
 
 	conf := influx_client.UDPConfig{Addr: addr}
@@ -92,6 +129,8 @@ func NewUDPInfluxSink(args map[string]string) (Emitter, error) {
 		client_config:    &conf,
 		pointBox:         pointBox,
 		collectorRunning: false,
+		stop:             make(chan struct{}),
+		stopped:          make(chan struct{}),
 	}
 	sink.StartCollector(flushInterval, flushCount)
 	return sink, nil
@@ -118,34 +157,47 @@ func (s *UDPInfluxSink) newBatchPoints() influx_client.BatchPoints {
 	return bp
 }
 
+func (s *UDPInfluxSink) flush(bp influx_client.BatchPoints) influx_client.BatchPoints {
+	if len(bp.Points()) == 0 {
+		return bp
+	}
+	err := s.Client.Write(bp)
+	if err != nil {
+		log.Errorf("InfluxSink encountered problem while writing to db: %s", err)
+	}
+	return s.newBatchPoints()
+}
+
 func (s *UDPInfluxSink) collectorRoutine(flushInterval time.Duration, flushCount int) {
-	defer s.Client.Close()
+	defer close(s.stopped)
+	defer func() { s.Client.Close() }()
+	ticker := time.NewTicker(flushInterval * time.Second)
+	defer ticker.Stop()
 	bp := s.newBatchPoints()
 	for {
 		select {
-		case <-time.Tick(flushInterval * time.Second):
+		case <-ticker.C:
 			log.Debug("InfluxSink reached flush interval - flushing batch points")
-			err := s.Client.Write(bp)
-			if err != nil {
-				log.Errorf("InfluxSink encountered problem while writing to db: %s", err)
-			}
-			bp = s.newBatchPoints()
+			bp = s.flush(bp)
 		case point := <-s.pointBox:
 			log.Debug("Received data point")
 			bp.AddPoint(point)
 			if len(bp.Points()) >= flushCount {
 				log.Debug("InfluxSink reached flush count - flushing batch points")
-				err := s.Client.Write(bp)
-				if err != nil {
-					log.Errorf("InfluxSink encountered problem while writing to db: %s", err)
-				}
-				bp = s.newBatchPoints()
+				bp = s.flush(bp)
+			}
+		case <-s.stop:
+			log.Debug("InfluxSink stopping - flushing batch points")
+			for len(s.pointBox) > 0 {
+				bp.AddPoint(<-s.pointBox)
 			}
+			s.flush(bp)
+			return
 		}
 	}
 }
 
-func (s *UDPInfluxSink) Emit(name, checkType string, c *Result) {
+func (s *UDPInfluxSink) Emit(name, checkType string, c *Result, state *CheckState) {
 	tags := map[string]string{
 		"name": name,
 		"type": checkType,
@@ -154,10 +206,150 @@ func (s *UDPInfluxSink) Emit(name, checkType string, c *Result) {
 		"result":   c.Result,
 		"duration": int64(c.Duration / time.Millisecond),
 	}
+	if c.Category != CategoryNone {
+		fields["category"] = string(c.Category)
+	}
+	if c.Message != "" {
+		fields["message"] = c.Message
+	}
+	if c.Attempts > 1 {
+		fields["attempts"] = c.Attempts
+	}
+	if c.Maintenance {
+		fields["maintenance"] = true
+	}
+	if state != nil {
+		fields["state"] = state.Status.String()
+		fields["state_changed"] = state.Changed
+	}
+	for metric, value := range c.Metrics {
+		// Metrics never replace the fields above.
+		if _, ok := fields[metric]; !ok {
+			fields[metric] = value
+		}
+	}
 	pt, _ := influx_client.NewPoint("healthcheck", tags, fields, c.Timestamp)
-	s.pointBox <- pt
+	select {
+	case s.pointBox <- pt:
+	case <-s.stop:
+		log.Errorf("InfluxSink is closed, dropping %s result", name)
+	}
 }
 
 func (s *UDPInfluxSink) Name() string {
 	return "UDPInfluxSink"
 }
+
+// Close stops the collector after it writes out any buffered points.
+func (s *UDPInfluxSink) Close() error {
+	if !s.collectorRunning {
+		return nil
+	}
+	close(s.stop)
+	<-s.stopped
+	s.collectorRunning = false
+	return nil
+}
+
+type notification struct {
+	result     ResultCode
+	notifiedAt time.Time
+}
+
+// StateChangeSink forwards a result to the wrapped sink only when its
+// ResultCode differs from the previous one for the same check, optionally
+// repeating failures every RemindEvery.
+type StateChangeSink struct {
+	Target      Emitter
+	RemindEvery time.Duration
+	mu          sync.Mutex
+	last        map[string]notification
+}
+
+func NewStateChangeSink(target Emitter, remindEvery time.Duration) *StateChangeSink {
+	return &StateChangeSink{
+		Target:      target,
+		RemindEvery: remindEvery,
+		last:        make(map[string]notification),
+	}
+}
+
+var StateChangeSinkArgs = ArgSchema{
+	Args: []ArgSpec{
+		{Name: "sink", Required: true, Description: "type of the wrapped sink, remaining args are passed to it"},
+		{Name: "sinkId", Description: "id of the wrapped sink"},
+		{Name: "remindEvery", Type: ArgInt, Default: "0", Description: "minutes between reminders while failing, 0 disables them"},
+	},
+	ForwardTo: "sink",
+}
+
+// NewStateChangeSink creates the sink named by the 'sink' arg, passing it the
+// remaining args, and wraps it in a StateChangeSink.
+func (c *Registry) NewStateChangeSink(args map[string]string) (Emitter, error) {
+	errPrefix := "Error creating StateChangeSink -"
+	remindEvery, err := StateChangeSinkArgs.Int(args, "remindEvery")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+	target, err := c.newWrappedSink(StateChangeSinkArgs, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+	return NewStateChangeSink(target, time.Duration(remindEvery)*time.Minute), nil
+}
+
+// newWrappedSink creates the sink named by the schema's ForwardTo arg for a
+// sink wrapping it. The wrapped sink gets every arg the schema doesn't list,
+// and 'sinkId' as its id.
+func (c *Registry) newWrappedSink(schema ArgSchema, args map[string]string) (Emitter, error) {
+	targetType, ok := args[schema.ForwardTo]
+	if !ok {
+		return nil, fmt.Errorf("%s parameter missing", schema.ForwardTo)
+	}
+	targetArgs := make(map[string]string)
+	for arg, value := range args {
+		if arg == "sinkId" {
+			targetArgs["id"] = value
+		} else if _, ok := schema.spec(arg); !ok {
+			targetArgs[arg] = value
+		}
+	}
+	return c.getOrCreateSink("", targetType, targetArgs)
+}
+
+func (s *StateChangeSink) shouldForward(name string, c *Result) bool {
+	if !c.notify() {
+		// Results during maintenance or while upstream is down aren't
+		// remembered, so a failure that outlasts them is forwarded as a
+		// change once they end.
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, seen := s.last[name]
+	forward := false
+	switch {
+	case !seen:
+		forward = c.Result != Success
+	case previous.result != c.Result:
+		forward = true
+	case c.Result != Success && s.RemindEvery > 0:
+		forward = c.Timestamp.Sub(previous.notifiedAt) >= s.RemindEvery
+	}
+	if forward || !seen || previous.result != c.Result {
+		s.last[name] = notification{result: c.Result, notifiedAt: c.Timestamp}
+	}
+	return forward
+}
+
+func (s *StateChangeSink) Emit(name, checkType string, c *Result, state *CheckState) {
+	if !s.shouldForward(name, c) {
+		log.Debugf("StateChangeSink suppressing %s result (%s)", name, c.Result)
+		return
+	}
+	s.Target.Emit(name, checkType, c, state)
+}
+
+func (s *StateChangeSink) Name() string {
+	return "StateChangeSink(" + s.Target.Name() + ")"
+}
@@ -17,8 +17,8 @@ func TestFileSinkEmit(t *testing.T) {
 	fs := fileSink.(*FileSink)
 	r, w, _ := os.Pipe()
 	fs.TargetFile = w
-	c := Result{time.Now(), Failure, time.Duration(1)}
-	fs.Emit("testCheck", "TestCheck", &c)
+	c := Result{Timestamp: time.Now(), Result: Failure, Duration: time.Duration(1)}
+	fs.Emit("testCheck", "TestCheck", &c, nil)
 	w.Close()
 
 	msg, _ := ioutil.ReadAll(r)
@@ -30,6 +30,26 @@ func TestFileSinkEmit(t *testing.T) {
 	}
 }
 
+func TestFileSinkEmitDetails(t *testing.T) {
+	fileSink, _ := NewFileSink(map[string]string{"path": "/tmp/someFile"})
+	fs := fileSink.(*FileSink)
+	r, w, _ := os.Pipe()
+	fs.TargetFile = w
+	c := Result{Timestamp: time.Now(), Result: Failure, Duration: time.Duration(1)}
+	c.Fail(Failure, CategoryStatus, "HTTP %s", "503 Service Unavailable")
+	c.SetMetric("status_code", 503)
+	c.SetMetric("bytes_read", 12)
+	fs.Emit("testCheck", "TestCheck", &c, &CheckState{Status: StatusDown, Previous: StatusUp, Changed: true})
+	w.Close()
+
+	msg, _ := ioutil.ReadAll(r)
+	matcher := `\[testCheck\]: Failure [0-9.s]+ \[status\] HTTP 503 Service Unavailable bytes_read=12 status_code=503 state=down \(was up\)\n$`
+
+	if match, _ := regexp.Match(matcher, msg); !match {
+		t.Errorf("Unexpected FileSink output: %s", msg)
+	}
+}
+
 func TestNewFileSink(t *testing.T) {
 	newSinkTests := []struct {
 		name    string
@@ -108,12 +128,116 @@ func TestUDPInfluxSinkEmitOnCount(t *testing.T) {
 	influxSink := sink.(*UDPInfluxSink)
 	influxSink.Client = &FakeClient{}
 
-	c := &Result{time.Now(), Failure, time.Duration(1)}
+	c := &Result{Timestamp: time.Now(), Result: Failure, Duration: time.Duration(1)}
 	fmt.Println(c)
-	sink.Emit("a testing check", "ExampleCheck", c)
+	sink.Emit("a testing check", "ExampleCheck", c, nil)
 	// TODO: create test that doesn't need sleeping
 	time.Sleep(2 * time.Second) // sleep for FlushInterval
 	if influxSink.Client.(*FakeClient).WriteCalled < 1 {
 		t.Errorf("Client didnt write or close: %v", influxSink.Client)
 	}
 }
+
+func TestUDPInfluxSinkCloseFlushes(t *testing.T) {
+	fakeClient := &FakeClient{}
+	influxSink := &UDPInfluxSink{
+		Client:   fakeClient,
+		pointBox: make(chan *influx_client.Point, 1),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	influxSink.StartCollector(60, 10)
+
+	influxSink.Emit("a testing check", "ExampleCheck", &Result{Timestamp: time.Now(), Result: Success}, &CheckState{Status: StatusUp})
+	influxSink.Close()
+
+	if fakeClient.WriteCalled != 1 || fakeClient.CloseCalled != 1 {
+		t.Errorf("Expected pending points to be written and client closed, got: %+v", fakeClient)
+	}
+	if influxSink.IsCollectorRunning() {
+		t.Errorf("Collector goro still running after Close")
+	}
+}
+
+func TestStateChangeSink(t *testing.T) {
+	target := &recordingSink{}
+	sink := NewStateChangeSink(target, 10*time.Minute)
+	start := time.Now()
+
+	emitTests := []struct {
+		check   string
+		after   time.Duration
+		result  ResultCode
+		forward bool
+	}{
+		{"web", 0, Success, false},
+		{"web", time.Minute, Success, false},
+		{"web", 2 * time.Minute, Failure, true},
+		{"db", 2 * time.Minute, Failure, true},
+		{"web", 3 * time.Minute, Failure, false},
+		{"web", 4 * time.Minute, Error, true},
+		{"web", 13 * time.Minute, Error, false},
+		{"web", 14 * time.Minute, Error, true},
+		{"web", 15 * time.Minute, Success, true},
+		{"web", 30 * time.Minute, Success, false},
+	}
+
+	for i, tt := range emitTests {
+		before := len(target.Results())
+		sink.Emit(tt.check, "TestCheck", &Result{Timestamp: start.Add(tt.after), Result: tt.result}, nil)
+		if forwarded := len(target.Results()) > before; forwarded != tt.forward {
+			t.Errorf("Step %d (%s %s at +%s): forwarded=%v, wanted %v", i, tt.check, tt.result, tt.after, forwarded, tt.forward)
+		}
+	}
+}
+
+func TestStateChangeSinkMaintenance(t *testing.T) {
+	target := &recordingSink{}
+	sink := NewStateChangeSink(target, 0)
+	start := time.Now()
+
+	sink.Emit("web", "TestCheck", &Result{Timestamp: start, Result: Success}, nil)
+	sink.Emit("web", "TestCheck", &Result{Timestamp: start.Add(time.Minute), Result: Failure, Maintenance: true}, nil)
+	if results := target.Results(); len(results) != 0 {
+		t.Fatalf("Expected results in maintenance to be suppressed, got: %+v", results)
+	}
+	sink.Emit("web", "TestCheck", &Result{Timestamp: start.Add(2 * time.Minute), Result: Failure}, nil)
+	if results := target.Results(); len(results) != 1 || results[0].Result != Failure {
+		t.Errorf("Expected a failure outlasting maintenance to be forwarded, got: %+v", results)
+	}
+}
+
+func TestRegistryNewStateChangeSink(t *testing.T) {
+	registry := NewRegistry()
+	var targetArgs map[string]string
+	target := &recordingSink{}
+	registry.SinkConstructors["RecordingSink"] = func(args map[string]string) (Emitter, error) {
+		targetArgs = args
+		return target, nil
+	}
+	registry.SinkConstructors["StateChangeSink"] = registry.NewStateChangeSink
+
+	sinks, err := registry.setupSinks("some check", []map[string]map[string]string{{
+		"StateChangeSink": {"sink": "RecordingSink", "sinkId": "shared", "remindEvery": "5", "path": "/tmp/x"},
+	}})
+	if err != nil {
+		t.Fatalf("Couldn't create StateChangeSink: %s", err)
+	}
+	wrapper := sinks[0].(*StateChangeSink)
+	if wrapper.Target != target || wrapper.RemindEvery != 5*time.Minute {
+		t.Errorf("Wrapper not configured from args: %+v", wrapper)
+	}
+	if len(targetArgs) != 1 || targetArgs["path"] != "/tmp/x" {
+		t.Errorf("Wrapped sink got unexpected args: %v", targetArgs)
+	}
+	if registry.Sinks["shared"] != target {
+		t.Errorf("Wrapped sink should be registered under its sinkId")
+	}
+
+	_, err = registry.setupSinks("some check", []map[string]map[string]string{{
+		"StateChangeSink": {"sink": "NoSuchSink"},
+	}})
+	if err == nil {
+		t.Errorf("Expected error when wrapping an unknown sink type")
+	}
+}
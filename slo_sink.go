@@ -0,0 +1,336 @@
+package healthchecker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSLOWindowDays = 30
+	// The multiwindow alerts from the Google SRE workbook: the first two page
+	// after 2% and 5% of a 30 day budget is spent, the others open a ticket
+	// after 10%.
+	defaultSLOAlerts = "1h/5m:14.4,6h/30m:6,24h/2h:3,72h/6h:1"
+	sloBurnRateType  = "SLOBurnRate"
+	// Alert windows are counted in fine buckets, the SLO window in coarse
+	// ones to keep the memory per check small.
+	sloFineBucket   = time.Minute
+	sloCoarseBucket = time.Hour
+)
+
+// BurnRateAlert fires while the error budget is being spent at least Factor
+// times faster than it would be by failing at exactly the objective, over
+// both Long and Short.
+type BurnRateAlert struct {
+	Long   time.Duration
+	Short  time.Duration
+	Factor float64
+}
+
+// ParseBurnRateAlerts parses a comma separated list of alerts written as
+// long/short:factor, eg. 1h/5m:14.4.
+func ParseBurnRateAlerts(value string) ([]BurnRateAlert, error) {
+	alerts := make([]BurnRateAlert, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		windows := strings.SplitN(item, ":", 2)
+		durations := strings.SplitN(windows[0], "/", 2)
+		if len(windows) != 2 || len(durations) != 2 {
+			return nil, fmt.Errorf("burn rate alert must look like 1h/5m:14.4, got: %s", item)
+		}
+		long, err := time.ParseDuration(durations[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid long window in burn rate alert %s: %s", item, err)
+		}
+		short, err := time.ParseDuration(durations[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid short window in burn rate alert %s: %s", item, err)
+		}
+		factor, err := strconv.ParseFloat(windows[1], 64)
+		if err != nil || factor <= 0 {
+			return nil, fmt.Errorf("burn rate alert factor must be a positive number, got: %s", item)
+		}
+		if short <= 0 || long < short {
+			return nil, fmt.Errorf("burn rate alert windows must be positive with the long one first, got: %s", item)
+		}
+		alerts = append(alerts, BurnRateAlert{Long: long, Short: short, Factor: factor})
+	}
+	return alerts, nil
+}
+
+// SLO is a service level objective of a check. A result is good when it
+// succeeded and, for latency SLOs, took at most Latency. Objective is the
+// fraction of results that should be good over Window.
+type SLO struct {
+	Name      string
+	Objective float64
+	Latency   time.Duration
+	Window    time.Duration
+	Alerts    []BurnRateAlert
+}
+
+func (s *SLO) good(res *Result) bool {
+	return res.Result == Success && (s.Latency == 0 || res.Duration <= s.Latency)
+}
+
+func (s *SLO) String() string {
+	days := s.Window / (hoursInDay * time.Hour)
+	if s.Latency > 0 {
+		return fmt.Sprintf("%s SLO (%g%% under %s over %dd)", s.Name, s.Objective*100, s.Latency, days)
+	}
+	return fmt.Sprintf("%s SLO (%g%% over %dd)", s.Name, s.Objective*100, days)
+}
+
+// burnRate is how many times faster than allowed the budget is being spent
+// given good out of total results.
+func (s *SLO) burnRate(good, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(total-good) / float64(total) / (1 - s.Objective)
+}
+
+type sloBucket struct {
+	slot  int64
+	good  int
+	total int
+}
+
+// rollingCounter counts good and total results in a ring of buckets of
+// width, so a sum over any window costs one read per bucket.
+type rollingCounter struct {
+	width   time.Duration
+	buckets []sloBucket
+}
+
+func newRollingCounter(width, span time.Duration) *rollingCounter {
+	return &rollingCounter{width: width, buckets: make([]sloBucket, int(span/width)+1)}
+}
+
+func (r *rollingCounter) slot(t time.Time) int64 {
+	return t.UnixNano() / int64(r.width)
+}
+
+func (r *rollingCounter) add(t time.Time, good bool) {
+	slot := r.slot(t)
+	bucket := &r.buckets[slot%int64(len(r.buckets))]
+	if bucket.slot != slot {
+		*bucket = sloBucket{slot: slot}
+	}
+	bucket.total++
+	if good {
+		bucket.good++
+	}
+}
+
+// sum counts the results in the buckets covering window up to now.
+func (r *rollingCounter) sum(now time.Time, window time.Duration) (good, total int) {
+	last := r.slot(now)
+	count := int64((window + r.width - 1) / r.width)
+	if count > int64(len(r.buckets)) {
+		count = int64(len(r.buckets))
+	}
+	for slot := last - count + 1; slot <= last; slot++ {
+		bucket := r.buckets[slot%int64(len(r.buckets))]
+		if bucket.slot == slot {
+			good += bucket.good
+			total += bucket.total
+		}
+	}
+	return good, total
+}
+
+type sloTracker struct {
+	fine   *rollingCounter
+	coarse *rollingCounter
+	firing []bool
+	// since is the time of the first result counted, an alert isn't
+	// evaluated before its long window is covered.
+	since time.Time
+}
+
+// SLOSink tracks an SLO for every check it receives results of and emits a
+// result of type SLOBurnRate to Target whenever one of the SLO's burn rate
+// alerts starts or stops firing. A firing alert is a Failure, a resolved one
+// a Success, and both carry the burn rates, the SLI and the remaining error
+// budget as metrics. An alert only fires once results cover its long window,
+// if History is set the windows of a check start from its recorded results.
+type SLOSink struct {
+	SLO     SLO
+	Target  Emitter
+	History History
+	mu      sync.Mutex
+	checks  map[string]*sloTracker
+}
+
+func NewSLOSink(slo SLO, target Emitter) *SLOSink {
+	return &SLOSink{SLO: slo, Target: target, checks: make(map[string]*sloTracker)}
+}
+
+var SLOSinkArgs = ArgSchema{
+	Args: []ArgSpec{
+		{Name: "sink", Required: true, Description: "type of the sink burn rate alerts are sent to, remaining args are passed to it"},
+		{Name: "sinkId", Description: "id of the wrapped sink"},
+		{Name: "objective", Type: ArgFloat, Required: true, Description: "percentage of results that should be good, eg. 99.9"},
+		{Name: "latency", Type: ArgInt, Default: "0", Description: "milliseconds a good result may take at most, 0 only counts failures"},
+		{Name: "window", Type: ArgInt, Default: strconv.Itoa(defaultSLOWindowDays), Description: "days the objective is measured over"},
+		{Name: "alerts", Default: defaultSLOAlerts, Description: "burn rate alerts as long/short:factor"},
+		{Name: "name", Description: "name of the SLO in alerts, availability or latency by default"},
+	},
+	ForwardTo: "sink",
+}
+
+// NewSLOSink creates the sink named by the 'sink' arg, passing it the
+// remaining args, and sends it the burn rate alerts of the SLO.
+func (c *Registry) NewSLOSink(args map[string]string) (Emitter, error) {
+	errPrefix := "Error creating SLOSink -"
+	objective, err := strconv.ParseFloat(args["objective"], 64)
+	if err != nil || objective <= 0 || objective >= 100 {
+		return nil, fmt.Errorf("%s objective must be a percentage between 0 and 100, got: %s", errPrefix, args["objective"])
+	}
+	latency, err := SLOSinkArgs.Int(args, "latency")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+	window, err := SLOSinkArgs.Int(args, "window")
+	if err != nil || window < 1 {
+		return nil, fmt.Errorf("%s window must be at least 1 day", errPrefix)
+	}
+	alertsArg, _ := SLOSinkArgs.Lookup(args, "alerts")
+	alerts, err := ParseBurnRateAlerts(alertsArg)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+	slo := SLO{
+		Name:      args["name"],
+		Objective: objective / 100,
+		Latency:   time.Duration(latency) * time.Millisecond,
+		Window:    time.Duration(window) * hoursInDay * time.Hour,
+		Alerts:    alerts,
+	}
+	if slo.Name == "" {
+		slo.Name = "availability"
+		if slo.Latency > 0 {
+			slo.Name = "latency"
+		}
+	}
+
+	target, err := c.newWrappedSink(SLOSinkArgs, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+	sink := NewSLOSink(slo, target)
+	sink.History = c.History
+	return sink, nil
+}
+
+func (s *SLOSink) tracker(name string, now time.Time) *sloTracker {
+	tracker, ok := s.checks[name]
+	if !ok {
+		var longest time.Duration
+		for _, alert := range s.SLO.Alerts {
+			if alert.Long > longest {
+				longest = alert.Long
+			}
+		}
+		tracker = &sloTracker{
+			fine:   newRollingCounter(sloFineBucket, longest),
+			coarse: newRollingCounter(sloCoarseBucket, s.SLO.Window),
+			firing: make([]bool, len(s.SLO.Alerts)),
+			since:  now,
+		}
+		s.seed(name, tracker, now.Add(-longest), now)
+		s.checks[name] = tracker
+	}
+	return tracker
+}
+
+// seed counts the results of name recorded in History from from up to now.
+func (s *SLOSink) seed(name string, tracker *sloTracker, from, now time.Time) {
+	if s.History == nil {
+		return
+	}
+	entries, err := s.History.Entries(name, from, now)
+	if err != nil {
+		log.Errorf("Couldn't read the history of %s for its %s: %s", name, s.SLO.String(), err)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.observed() {
+			continue
+		}
+		good := s.SLO.good(&Result{Result: entry.Result, Duration: entry.Duration})
+		tracker.fine.add(entry.Timestamp, good)
+		tracker.coarse.add(entry.Timestamp, good)
+		if entry.Timestamp.Before(tracker.since) {
+			tracker.since = entry.Timestamp
+		}
+	}
+}
+
+// record counts res and returns an alert result for every burn rate alert
+// that started or stopped firing.
+func (s *SLOSink) record(name string, res *Result) []*Result {
+	now := res.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tracker := s.tracker(name, now)
+	good := s.SLO.good(res)
+	tracker.fine.add(now, good)
+	tracker.coarse.add(now, good)
+
+	events := make([]*Result, 0)
+	for i, alert := range s.SLO.Alerts {
+		if now.Sub(tracker.since) < alert.Long {
+			continue
+		}
+		longRate := s.SLO.burnRate(tracker.fine.sum(now, alert.Long))
+		shortRate := s.SLO.burnRate(tracker.fine.sum(now, alert.Short))
+		firing := longRate >= alert.Factor && shortRate >= alert.Factor
+		if firing == tracker.firing[i] {
+			continue
+		}
+		tracker.firing[i] = firing
+
+		windowGood, windowTotal := tracker.coarse.sum(now, s.SLO.Window)
+		event := &Result{Timestamp: now, Result: Success}
+		event.SetMetric("burn_rate_long", longRate)
+		event.SetMetric("burn_rate_short", shortRate)
+		event.SetMetric("burn_rate_threshold", alert.Factor)
+		event.SetMetric("error_budget_remaining", 1-s.SLO.burnRate(windowGood, windowTotal))
+		if windowTotal > 0 {
+			event.SetMetric("sli", float64(windowGood)/float64(windowTotal)*100)
+		}
+		if firing {
+			event.Fail(Failure, CategorySLO, "%s is burning its error budget %.1fx over %s and %.1fx over %s, alerting at %gx",
+				s.SLO.String(), longRate, alert.Long, shortRate, alert.Short, alert.Factor)
+		} else {
+			event.Message = fmt.Sprintf("%s burn rate over %s/%s is back below %gx",
+				s.SLO.String(), alert.Long, alert.Short, alert.Factor)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func (s *SLOSink) Emit(name, checkType string, c *Result, state *CheckState) {
+	if !c.notify() {
+		return
+	}
+	for _, event := range s.record(name, c) {
+		log.Infof("%s: %s", name, event.Message)
+		s.Target.Emit(name, sloBurnRateType, event, nil)
+	}
+}
+
+func (s *SLOSink) Name() string {
+	return "SLOSink(" + s.Target.Name() + ")"
+}
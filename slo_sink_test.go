@@ -0,0 +1,187 @@
+package healthchecker
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBurnRateAlerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		succeed bool
+	}{
+		{"default", defaultSLOAlerts, true},
+		{"single", "2h/10m:5", true},
+		{"no factor", "1h/5m", false},
+		{"no short window", "1h:14.4", false},
+		{"bad duration", "1x/5m:2", false},
+		{"short longer than long", "5m/1h:2", false},
+		{"zero factor", "1h/5m:0", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseBurnRateAlerts(test.value)
+			if (err == nil) != test.succeed {
+				t.Errorf("Expected success %t, got error: %v", test.succeed, err)
+			}
+		})
+	}
+
+	alerts, _ := ParseBurnRateAlerts(defaultSLOAlerts)
+	if len(alerts) != 4 || alerts[0] != (BurnRateAlert{Long: time.Hour, Short: 5 * time.Minute, Factor: 14.4}) {
+		t.Errorf("Unexpected default alerts: %+v", alerts)
+	}
+}
+
+func TestRollingCounter(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	counter := newRollingCounter(time.Minute, 10*time.Minute)
+	for i := 0; i < 30; i++ {
+		counter.add(start.Add(time.Duration(i)*time.Minute), i%2 == 0)
+	}
+	now := start.Add(29 * time.Minute)
+	if good, total := counter.sum(now, 4*time.Minute); good != 2 || total != 4 {
+		t.Errorf("Expected 2 of 4 good, got %d of %d", good, total)
+	}
+	// Older buckets have been reused, so windows are capped at the span.
+	if _, total := counter.sum(now, time.Hour); total != 11 {
+		t.Errorf("Expected the window to be capped at 11 buckets, got %d", total)
+	}
+	if _, total := counter.sum(now.Add(time.Hour), 10*time.Minute); total != 0 {
+		t.Errorf("Expected stale buckets to be ignored, got %d", total)
+	}
+}
+
+func TestSLOSink(t *testing.T) {
+	target := &recordingSink{}
+	sink := NewSLOSink(SLO{
+		Name:      "availability",
+		Objective: 0.99,
+		Window:    30 * hoursInDay * time.Hour,
+		Alerts:    []BurnRateAlert{{Long: time.Hour, Short: 5 * time.Minute, Factor: 9.5}},
+	}, target)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	emit := func(minute int, code ResultCode) int {
+		before := len(target.Results())
+		sink.Emit("web", "TestCheck", &Result{Timestamp: start.Add(time.Duration(minute) * time.Minute), Result: code}, nil)
+		return len(target.Results()) - before
+	}
+
+	for minute := 0; minute < 60; minute++ {
+		if emit(minute, Success) != 0 {
+			t.Fatalf("Unexpected alert at minute %d", minute)
+		}
+	}
+	// Both windows have to burn 9.5x the budget: 6 failures in an hour.
+	for minute := 60; minute < 65; minute++ {
+		if emit(minute, Failure) != 0 {
+			t.Fatalf("Alert fired too early at minute %d", minute)
+		}
+	}
+	if emit(65, Failure) != 1 {
+		t.Fatalf("Expected the alert to fire")
+	}
+	alert := target.Results()[0]
+	if alert.Result != Failure || alert.Category != CategorySLO || !strings.Contains(alert.Message, "availability SLO (99% over 30d)") {
+		t.Errorf("Unexpected alert: %+v", alert)
+	}
+	if math.Abs(alert.Metrics["burn_rate_long"]-10) > 1e-6 || math.Abs(alert.Metrics["burn_rate_short"]-100) > 1e-6 {
+		t.Errorf("Unexpected burn rates: %v", alert.Metrics)
+	}
+
+	// The short window recovers as soon as it's clean again.
+	for minute := 66; minute < 70; minute++ {
+		if emit(minute, Success) != 0 {
+			t.Fatalf("Alert resolved too early at minute %d", minute)
+		}
+	}
+	if emit(70, Success) != 1 || target.Results()[1].Result != Success {
+		t.Errorf("Expected the alert to resolve, got: %+v", target.Results())
+	}
+
+	// Other checks are tracked separately, and only alert once their results
+	// cover the long window.
+	sink.Emit("db", "TestCheck", &Result{Timestamp: start.Add(70 * time.Minute), Result: Failure}, nil)
+	if len(target.Results()) != 2 {
+		t.Errorf("Expected a single failure of a fresh check not to alert, got: %+v", target.Results()[2:])
+	}
+}
+
+func TestSLOSinkHistory(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := NewMemoryHistory(0)
+	for minute := 0; minute < 60; minute++ {
+		history.Record("web", HistoryEntry{Timestamp: start.Add(time.Duration(minute) * time.Minute), Result: Success})
+	}
+	// Results while upstream was down don't count.
+	history.Record("web", HistoryEntry{Timestamp: start.Add(60 * time.Minute), Result: UpstreamDown})
+
+	target := &recordingSink{}
+	sink := NewSLOSink(SLO{
+		Name:      "availability",
+		Objective: 0.99,
+		Window:    30 * hoursInDay * time.Hour,
+		Alerts:    []BurnRateAlert{{Long: time.Hour, Short: 5 * time.Minute, Factor: 9.5}},
+	}, target)
+	sink.History = history
+	for minute := 61; minute < 67; minute++ {
+		sink.Emit("web", "TestCheck", &Result{Timestamp: start.Add(time.Duration(minute) * time.Minute), Result: Failure}, nil)
+	}
+	results := target.Results()
+	if len(results) != 1 || results[0].Result != Failure {
+		t.Fatalf("Expected the recorded results to cover the window and the alert to fire, got: %+v", results)
+	}
+	if math.Abs(results[0].Metrics["burn_rate_long"]-6.0/59/0.01) > 1e-6 {
+		t.Errorf("Expected the recorded results to be counted, got: %v", results[0].Metrics)
+	}
+}
+
+func TestSLOLatency(t *testing.T) {
+	slo := SLO{Objective: 0.95, Latency: 300 * time.Millisecond}
+	if !slo.good(&Result{Result: Success, Duration: 300 * time.Millisecond}) {
+		t.Error("Expected a result within the latency to be good")
+	}
+	if slo.good(&Result{Result: Success, Duration: 301 * time.Millisecond}) {
+		t.Error("Expected a slow result to be bad")
+	}
+	if slo.good(&Result{Result: Failure, Duration: time.Millisecond}) {
+		t.Error("Expected a failure to be bad")
+	}
+}
+
+func TestRegistryNewSLOSink(t *testing.T) {
+	registry := NewRegistry()
+	target := &recordingSink{}
+	var targetArgs map[string]string
+	registry.SinkConstructors["RecordingSink"] = func(args map[string]string) (Emitter, error) {
+		targetArgs = args
+		return target, nil
+	}
+
+	emitter, err := registry.NewSLOSink(map[string]string{
+		"sink": "RecordingSink", "objective": "99.5", "latency": "300", "window": "7", "alerts": "1h/5m:14.4", "path": "/tmp/x",
+	})
+	if err != nil {
+		t.Fatalf("Couldn't create SLOSink: %s", err)
+	}
+	sink := emitter.(*SLOSink)
+	if sink.Target != target || sink.SLO.Name != "latency" || sink.SLO.Objective != 0.995 ||
+		sink.SLO.Latency != 300*time.Millisecond || sink.SLO.Window != 7*hoursInDay*time.Hour || len(sink.SLO.Alerts) != 1 {
+		t.Errorf("SLOSink not configured from args: %+v", sink.SLO)
+	}
+	if len(targetArgs) != 1 || targetArgs["path"] != "/tmp/x" {
+		t.Errorf("Wrapped sink got unexpected args: %v", targetArgs)
+	}
+
+	for _, objective := range []string{"100", "0", "high"} {
+		if _, err := registry.NewSLOSink(map[string]string{"sink": "RecordingSink", "objective": objective}); err == nil {
+			t.Errorf("Expected objective %s to be rejected", objective)
+		}
+	}
+	if _, err := registry.NewSLOSink(map[string]string{"sink": "RecordingSink", "objective": "99", "alerts": "1h"}); err == nil {
+		t.Error("Expected invalid alerts to be rejected")
+	}
+}
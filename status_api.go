@@ -0,0 +1,328 @@
+package healthchecker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const statusCloseDeadline = 5 * time.Second
+
+// ResultStatus is the JSON form of a Result.
+type ResultStatus struct {
+	Timestamp   time.Time          `json:"timestamp"`
+	Result      string             `json:"result"`
+	Duration    float64            `json:"durationSeconds"`
+	Message     string             `json:"message,omitempty"`
+	Category    ErrorCategory      `json:"category,omitempty"`
+	Metrics     map[string]float64 `json:"metrics,omitempty"`
+	Attempts    int                `json:"attempts,omitempty"`
+	Maintenance bool               `json:"maintenance,omitempty"`
+}
+
+// CheckStatus is the JSON form of a check and its current state.
+type CheckStatus struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Component   string        `json:"component,omitempty"`
+	Critical    bool          `json:"critical"`
+	Status      string        `json:"status"`
+	Since       *time.Time    `json:"since,omitempty"`
+	Interval    float64       `json:"intervalSeconds"`
+	Schedule    string        `json:"schedule"`
+	Tags        []string      `json:"tags,omitempty"`
+	DependsOn   []string      `json:"dependsOn,omitempty"`
+	Maintenance string        `json:"maintenance,omitempty"` // why the check is in maintenance now
+	LastResult  *ResultStatus `json:"lastResult,omitempty"`
+}
+
+// HealthzStatus is the response of the /healthz endpoint.
+type HealthzStatus struct {
+	Status string   `json:"status"`
+	Down   []string `json:"down,omitempty"`
+}
+
+func NewCheckStatus(h *HealthCheck) CheckStatus {
+	state := h.State()
+	status := CheckStatus{
+		Name:      h.Name,
+		Type:      h.Type,
+		Component: h.Component,
+		Critical:  h.Critical,
+		Status:    state.Status.String(),
+		Interval:  h.Interval.Seconds(),
+		Schedule:  h.Schedule.String(),
+		Tags:      h.Tags,
+		DependsOn: h.DependsOn,
+	}
+	if !state.Since.IsZero() {
+		status.Since = &state.Since
+	}
+	if reason, ok := h.InMaintenance(time.Now()); ok {
+		status.Maintenance = reason
+	}
+	if res := h.LastResult(); res != nil {
+		status.LastResult = &ResultStatus{
+			Timestamp:   res.Timestamp,
+			Result:      res.Result.String(),
+			Duration:    res.Duration.Seconds(),
+			Message:     res.Message,
+			Category:    res.Category,
+			Metrics:     res.Metrics,
+			Attempts:    res.Attempts,
+			Maintenance: res.Maintenance,
+		}
+	}
+	return status
+}
+
+// StatusHandler serves the current state of the registry's checks as JSON
+// on /checks and /checks/<name>, and their uptime reports on /uptime and
+// /checks/<name>/uptime. /healthz responds with 503 while any critical check
+// is down and / is the HTML status page.
+//
+// Silences are listed on /silences, created by POSTing a SilenceRequest to
+// it and expired with DELETE /silences/<id>. Both need SilenceToken as a
+// bearer token and are forbidden while it's empty.
+type StatusHandler struct {
+	Registry     *Registry
+	Page         *StatusPage
+	SilenceToken string
+	mux          *http.ServeMux
+}
+
+// SilenceRequest creates a silence lasting Duration, eg. 2h, or until
+// Expires.
+type SilenceRequest struct {
+	MaintenanceScope
+	All      bool      `json:"all,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+}
+
+// Silence turns the request into a silence starting at now.
+func (r *SilenceRequest) Silence(now time.Time) (Silence, error) {
+	silence := Silence{MaintenanceScope: r.MaintenanceScope, All: r.All, Comment: r.Comment, Start: now, Expires: r.Expires}
+	if r.Duration != "" {
+		if !r.Expires.IsZero() {
+			return silence, fmt.Errorf("'duration' and 'expires' cannot both be set")
+		}
+		duration, err := time.ParseDuration(r.Duration)
+		if err != nil {
+			return silence, fmt.Errorf("invalid duration: %s", err)
+		}
+		silence.Expires = now.Add(duration)
+	}
+	return silence, nil
+}
+
+func NewStatusHandler(registry *Registry) *StatusHandler {
+	h := &StatusHandler{Registry: registry, Page: NewStatusPage(registry), mux: http.NewServeMux()}
+	h.mux.Handle("/", h.Page)
+	h.mux.HandleFunc("/checks", h.serveChecks)
+	h.mux.HandleFunc("/checks/", h.serveCheck)
+	h.mux.HandleFunc("/healthz", h.serveHealthz)
+	h.mux.HandleFunc("/uptime", h.serveUptime)
+	h.mux.HandleFunc("/silences", h.serveSilences)
+	h.mux.HandleFunc("/silences/", h.serveSilence)
+	return h
+}
+
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowed := []string{http.MethodGet, http.MethodHead}
+	switch {
+	case r.URL.Path == "/silences":
+		allowed = append(allowed, http.MethodPost)
+	case strings.HasPrefix(r.URL.Path, "/silences/"):
+		allowed = []string{http.MethodDelete}
+	}
+	if !contains(allowed, r.Method) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("Error writing status response: %s", err)
+	}
+}
+
+func (h *StatusHandler) serveChecks(w http.ResponseWriter, r *http.Request) {
+	checks := h.Registry.CurrentChecks()
+	statuses := make([]CheckStatus, 0, len(checks))
+	for _, chk := range checks {
+		statuses = append(statuses, NewCheckStatus(chk))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (h *StatusHandler) serveCheck(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/checks/")
+	uptime := strings.HasSuffix(name, "/uptime")
+	name = strings.TrimSuffix(name, "/uptime")
+	for _, chk := range h.Registry.CurrentChecks() {
+		if chk.Name != name {
+			continue
+		}
+		if uptime {
+			h.serveCheckUptime(w, r, name)
+		} else {
+			writeJSON(w, http.StatusOK, NewCheckStatus(chk))
+		}
+		return
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no check named '%s'", name)})
+}
+
+// reportWindow reads the report window from the from and to query
+// parameters, writing an error response if they're invalid.
+func reportWindow(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+	from, to, err := ReportWindow(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func (h *StatusHandler) serveCheckUptime(w http.ResponseWriter, r *http.Request, name string) {
+	from, to, ok := reportWindow(w, r)
+	if !ok {
+		return
+	}
+	report, err := h.Registry.UptimeReport(name, from, to)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (h *StatusHandler) serveUptime(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportWindow(w, r)
+	if !ok {
+		return
+	}
+	reports, err := h.Registry.UptimeReports(from, to)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// authorized checks the request carries SilenceToken, writing an error
+// response if it doesn't.
+func (h *StatusHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.SilenceToken == "" {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "silences are read only, no SilenceToken is configured"})
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.SilenceToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return false
+	}
+	return true
+}
+
+func (h *StatusHandler) serveSilences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusOK, h.Registry.Maintenance.Silences())
+		return
+	}
+	if !h.authorized(w, r) {
+		return
+	}
+	var request SilenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid silence: %s", err)})
+		return
+	}
+	silence, err := request.Silence(time.Now())
+	if err == nil {
+		silence, err = h.Registry.Maintenance.AddSilence(silence)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Infof("Added silence %s until %s: %s", silence.ID, silence.Expires.Format(time.RFC3339), silence.Comment)
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+func (h *StatusHandler) serveSilence(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/silences/")
+	if err := h.Registry.Maintenance.ExpireSilence(id); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Infof("Expired silence %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *StatusHandler) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	healthz := HealthzStatus{Status: "ok"}
+	for _, chk := range h.Registry.CurrentChecks() {
+		if chk.Critical && chk.State().Status == StatusDown {
+			healthz.Down = append(healthz.Down, chk.Name)
+		}
+	}
+	if len(healthz.Down) > 0 {
+		healthz.Status = "down"
+		writeJSON(w, http.StatusServiceUnavailable, healthz)
+		return
+	}
+	writeJSON(w, http.StatusOK, healthz)
+}
+
+// StatusServer serves a StatusHandler on its own listener.
+type StatusServer struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+func NewStatusServer(addr string, handler http.Handler) (*StatusServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating status server - cannot listen on %s: %s", addr, err)
+	}
+	s := &StatusServer{
+		server:   &http.Server{Handler: handler},
+		listener: listener,
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Status server stopped serving: %s", err)
+		}
+	}()
+	return s, nil
+}
+
+// Addr is the address the status server is listening on.
+func (s *StatusServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *StatusServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), statusCloseDeadline)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
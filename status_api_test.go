@@ -0,0 +1,205 @@
+package healthchecker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	ht "net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStatusRegistry() *Registry {
+	registry := NewRegistry()
+	registry.CheckConstructors["result"] = func(args map[string]string) (CheckFunc, error) {
+		code := Success
+		if args["fail"] == "true" {
+			code = Failure
+		}
+		return func(_ context.Context) *Result {
+			return &Result{Timestamp: time.Now(), Result: code, Message: args["message"]}
+		}, nil
+	}
+	registry.AddCheck("web", "result", map[string]string{}, 5, nil)
+	registry.AddCheck("db", "result", map[string]string{"fail": "true", "message": "refused"}, 5, nil)
+	for _, chk := range registry.Checks {
+		chk.Run(context.Background())
+	}
+	return registry
+}
+
+func getStatus(t *testing.T, handler http.Handler, path string, body interface{}) int {
+	rec := ht.NewRecorder()
+	handler.ServeHTTP(rec, ht.NewRequest(http.MethodGet, path, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON response, got: %s", ct)
+	}
+	contents, _ := ioutil.ReadAll(rec.Body)
+	if err := json.Unmarshal(contents, body); err != nil {
+		t.Fatalf("Couldn't decode %s: %s", contents, err)
+	}
+	return rec.Code
+}
+
+func TestStatusHandlerChecks(t *testing.T) {
+	handler := NewStatusHandler(newStatusRegistry())
+
+	var checks []CheckStatus
+	if code := getStatus(t, handler, "/checks", &checks); code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+	if len(checks) != 2 || checks[0].Name != "web" || checks[0].Status != "up" {
+		t.Fatalf("Unexpected checks: %+v", checks)
+	}
+	if last := checks[1].LastResult; last == nil || last.Result != "Failure" || last.Message != "refused" {
+		t.Errorf("Unexpected last result: %+v", last)
+	}
+
+	var check CheckStatus
+	if code := getStatus(t, handler, "/checks/db", &check); code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+	if check.Name != "db" || check.Status != "down" || check.Since == nil {
+		t.Errorf("Unexpected check: %+v", check)
+	}
+
+	var notFound map[string]string
+	if code := getStatus(t, handler, "/checks/nope", &notFound); code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", code)
+	}
+}
+
+func TestStatusHandlerHealthz(t *testing.T) {
+	registry := newStatusRegistry()
+	handler := NewStatusHandler(registry)
+
+	var healthz HealthzStatus
+	if code := getStatus(t, handler, "/healthz", &healthz); code != http.StatusOK || healthz.Status != "ok" {
+		t.Errorf("Non-critical failing check shouldn't fail healthz, got %d: %+v", code, healthz)
+	}
+
+	registry.Checks[1].Critical = true
+	healthz = HealthzStatus{}
+	if code := getStatus(t, handler, "/healthz", &healthz); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with a critical check down, got %d", code)
+	}
+	if healthz.Status != "down" || len(healthz.Down) != 1 || healthz.Down[0] != "db" {
+		t.Errorf("Unexpected healthz: %+v", healthz)
+	}
+}
+
+func TestStatusServer(t *testing.T) {
+	server, err := NewStatusServer("127.0.0.1:0", NewStatusHandler(newStatusRegistry()))
+	if err != nil {
+		t.Fatalf("Couldn't start status server: %s", err)
+	}
+	defer server.Close()
+
+	resp, err := http.Post("http://"+server.Addr().String()+"/checks", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Couldn't reach status server: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + server.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("Couldn't reach status server: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestStatusHandlerUptime(t *testing.T) {
+	registry := newStatusRegistry()
+	handler := NewStatusHandler(registry)
+
+	var errBody map[string]string
+	if code := getStatus(t, handler, "/uptime", &errBody); code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 without history, got %d", code)
+	}
+
+	registry.History = NewMemoryHistory(0)
+	now := time.Now()
+	registry.History.Record("db", HistoryEntry{Timestamp: now.Add(-2 * time.Hour), Status: StatusUp})
+	registry.History.Record("db", HistoryEntry{Timestamp: now.Add(-time.Hour), Status: StatusDown})
+	var reports []map[string]interface{}
+	if code := getStatus(t, handler, "/uptime?from=1d", &reports); code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+	if len(reports) != 2 || reports[0]["check"] != "web" || reports[0]["availabilityPercent"] != nil {
+		t.Errorf("Unexpected reports: %+v", reports)
+	}
+
+	var report map[string]interface{}
+	if code := getStatus(t, handler, "/checks/db/uptime?from=3h", &report); code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+	if report["check"] != "db" || report["incidents"] != 1.0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if code := getStatus(t, handler, "/checks/db/uptime?from=yesterday", &errBody); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid window, got %d", code)
+	}
+	if code := getStatus(t, handler, "/checks/nope/uptime", &errBody); code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", code)
+	}
+}
+
+func TestStatusHandlerSilences(t *testing.T) {
+	registry := newStatusRegistry()
+	handler := NewStatusHandler(registry)
+	send := func(method, path, token, body string) *ht.ResponseRecorder {
+		req := ht.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := ht.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	request := `{"checks": ["db"], "duration": "1h", "comment": "deploy"}`
+	if rec := send(http.MethodPost, "/silences", "", request); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without a SilenceToken, got %d", rec.Code)
+	}
+	handler.SilenceToken = "secret"
+	if rec := send(http.MethodPost, "/silences", "wrong", request); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %d", rec.Code)
+	}
+	if rec := send(http.MethodPost, "/silences", "secret", `{"duration": "1h"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a silence without scope, got %d", rec.Code)
+	}
+	rec := send(http.MethodPost, "/silences", "secret", request)
+	var silence Silence
+	if err := json.Unmarshal(rec.Body.Bytes(), &silence); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 and the silence, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var silences []Silence
+	if code := getStatus(t, handler, "/silences", &silences); code != http.StatusOK || len(silences) != 1 || silences[0].Comment != "deploy" {
+		t.Errorf("Unexpected silences, got %d: %+v", code, silences)
+	}
+	var check CheckStatus
+	getStatus(t, handler, "/checks/db", &check)
+	if check.Maintenance != "silence "+silence.ID {
+		t.Errorf("Expected db to be silenced, got: %+v", check)
+	}
+
+	if rec := send(http.MethodGet, "/silences/"+silence.ID, "secret", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+	if rec := send(http.MethodDelete, "/silences/"+silence.ID, "secret", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+	if rec := send(http.MethodDelete, "/silences/"+silence.ID, "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an expired silence, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,335 @@
+package healthchecker
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStatusPageTitle = "Service status"
+	defaultStatusPageDays  = 90
+	statusPageIncidentDays = 14
+	statusPageMaxIncidents = 10
+	statusPageRefresh      = 60
+	// The page is rendered at most this often however many visitors it
+	// has, since every render reads the history of every check.
+	statusPageCacheTTL = 30 * time.Second
+	// Days with at least this much uptime are shown as a minor outage
+	// rather than a major one.
+	minorOutageUptime = 0.95
+)
+
+const statusPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="{{ .Refresh }}">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; background: #f6f7f9; margin: 0; }
+main { max-width: 52rem; margin: 2rem auto; padding: 0 1rem; }
+h1 { font-size: 1.6rem; }
+h2 { font-size: 1.1rem; margin-top: 2rem; }
+.banner { padding: 1rem; border-radius: 4px; color: #fff; font-weight: bold; }
+.component { background: #fff; border: 1px solid #e1e4e8; border-radius: 4px; padding: 1rem; margin-top: 1rem; }
+.component header { display: flex; justify-content: space-between; }
+.state { font-weight: bold; }
+.bars { display: flex; gap: 1px; margin: .75rem 0 .25rem; height: 2rem; }
+.bars span { flex: 1; border-radius: 1px; }
+.legend { display: flex; justify-content: space-between; color: #6a737d; font-size: .8rem; }
+.operational, .up { background: #2da44e; }
+.degraded, .minor { background: #d4a72c; }
+.outage, .major { background: #cf222e; }
+.unknown, .nodata { background: #b1b7bf; }
+header .operational, header .degraded, header .outage, header .unknown { background: none; }
+header .operational { color: #2da44e; }
+header .degraded { color: #9a6700; }
+header .outage { color: #cf222e; }
+header .unknown { color: #6a737d; }
+ul.incidents { list-style: none; padding: 0; }
+ul.incidents li { background: #fff; border: 1px solid #e1e4e8; border-radius: 4px; padding: .75rem 1rem; margin-top: .5rem; }
+footer { color: #6a737d; font-size: .8rem; margin: 2rem 0; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{ .Title }}</h1>
+<div class="banner {{ .State.Class }}">{{ .State.Summary }}</div>
+{{ range .Components }}
+<section class="component">
+<header><span>{{ .Name }}</span><span class="state {{ .State.Class }}">{{ .State.Label }}</span></header>
+<div class="bars">{{ range .Days }}<span class="{{ .Class }}" title="{{ .Label }}"></span>{{ end }}</div>
+<div class="legend"><span>{{ $.Days }} days ago</span><span>{{ .Uptime }}</span><span>Today</span></div>
+</section>
+{{ end }}
+<h2>Incidents in the last {{ .IncidentDays }} days</h2>
+{{ if .Incidents }}
+<ul class="incidents">
+{{ range .Incidents }}<li><strong>{{ .Component }}</strong> was down {{ if .Ongoing }}since {{ .Start }} (ongoing){{ else }}from {{ .Start }} for {{ .Duration }}{{ end }}</li>
+{{ end }}
+</ul>
+{{ else }}
+<p>No incidents reported.</p>
+{{ end }}
+<footer>Updated {{ .Generated }}</footer>
+</main>
+</body>
+</html>
+`
+
+type pageState struct {
+	Class   string
+	Label   string
+	Summary string
+}
+
+var (
+	stateOperational = pageState{"operational", "Operational", "All systems operational"}
+	stateDegraded    = pageState{"degraded", "Partial outage", "Some systems are experiencing problems"}
+	stateOutage      = pageState{"outage", "Major outage", "Major outage in progress"}
+	stateUnknown     = pageState{"unknown", "No data", "Waiting for the first check results"}
+)
+
+type dayBar struct {
+	Class string
+	Label string
+}
+
+type componentView struct {
+	Name   string
+	State  pageState
+	Days   []dayBar
+	Uptime string
+	checks []*HealthCheck
+}
+
+type incidentView struct {
+	Component string
+	Start     string
+	Duration  string
+	Ongoing   bool
+	start     time.Time
+}
+
+type statusPageData struct {
+	Title        string
+	Refresh      int
+	Days         int
+	IncidentDays int
+	State        pageState
+	Components   []*componentView
+	Incidents    []incidentView
+	Generated    string
+}
+
+// StatusPage renders a public HTML status page of the registry's checks,
+// grouped by their component. Checks without a component aren't shown. It
+// only shows component names, states, daily uptime and incident times, never
+// check names or error messages.
+type StatusPage struct {
+	Registry *Registry
+	Title    string
+	Days     int
+	template *template.Template
+	mu       sync.Mutex
+	cached   *statusPageData
+	cachedAt time.Time
+}
+
+func NewStatusPage(registry *Registry) *StatusPage {
+	return &StatusPage{
+		Registry: registry,
+		Title:    defaultStatusPageTitle,
+		Days:     defaultStatusPageDays,
+		template: template.Must(template.New("status").Parse(statusPageTemplate)),
+	}
+}
+
+func (p *StatusPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := p.template.Execute(w, p.data(time.Now())); err != nil {
+		log.Errorf("Error rendering status page: %s", err)
+	}
+}
+
+// data returns the page data rendered within statusPageCacheTTL of now.
+func (p *StatusPage) data(now time.Time) *statusPageData {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cached == nil || now.Sub(p.cachedAt) >= statusPageCacheTTL {
+		p.cached, p.cachedAt = p.render(now), now
+	}
+	return p.cached
+}
+
+func componentState(checks []*HealthCheck) pageState {
+	down, unknown := 0, 0
+	for _, chk := range checks {
+		switch chk.State().Status {
+		case StatusDown, StatusFlapping:
+			down++
+		case StatusUnknown:
+			unknown++
+		}
+	}
+	switch {
+	case unknown == len(checks):
+		return stateUnknown
+	case down == 0:
+		return stateOperational
+	case down == len(checks)-unknown:
+		return stateOutage
+	default:
+		return stateDegraded
+	}
+}
+
+func overallState(components []*componentView) pageState {
+	known, outages, degraded := 0, 0, 0
+	for _, component := range components {
+		switch component.State {
+		case stateOutage:
+			outages++
+		case stateDegraded:
+			degraded++
+		}
+		if component.State != stateUnknown {
+			known++
+		}
+	}
+	switch {
+	case known == 0:
+		return stateUnknown
+	case outages == known:
+		return stateOutage
+	case outages > 0 || degraded > 0:
+		return stateDegraded
+	default:
+		return stateOperational
+	}
+}
+
+func formatUptime(downtime, observed time.Duration) string {
+	if observed == 0 {
+		return "no data"
+	}
+	return fmt.Sprintf("%.2f%% uptime", float64(observed-downtime)/float64(observed)*100)
+}
+
+// dayBars sums up the daily uptime reports of a component's checks, days
+// starting at firstDay.
+func dayBars(reports [][]UptimeReport, firstDay time.Time, days int) ([]dayBar, string) {
+	bars := make([]dayBar, days)
+	var allDowntime, allObserved time.Duration
+	for day := range bars {
+		var downtime, observed time.Duration
+		for _, checkReports := range reports {
+			downtime += checkReports[day].Downtime
+			observed += checkReports[day].Observed
+		}
+		allDowntime += downtime
+		allObserved += observed
+		class := "nodata"
+		if observed > 0 {
+			uptime := float64(observed-downtime) / float64(observed)
+			switch {
+			case uptime == 1:
+				class = "up"
+			case uptime >= minorOutageUptime:
+				class = "minor"
+			default:
+				class = "major"
+			}
+		}
+		date := firstDay.AddDate(0, 0, day).Format("2006-01-02")
+		bars[day] = dayBar{Class: class, Label: fmt.Sprintf("%s: %s", date, formatUptime(downtime, observed))}
+	}
+	return bars, formatUptime(allDowntime, allObserved)
+}
+
+func (p *StatusPage) render(now time.Time) *statusPageData {
+	now = now.UTC()
+	today := now.Truncate(hoursInDay * time.Hour)
+	since := today.AddDate(0, 0, 1-p.Days)
+	incidentsSince := now.AddDate(0, 0, -statusPageIncidentDays)
+
+	components := make([]*componentView, 0)
+	byName := make(map[string]*componentView)
+	for _, chk := range p.Registry.CurrentChecks() {
+		name := chk.Component
+		if name == "" {
+			continue
+		}
+		component, ok := byName[name]
+		if !ok {
+			component = &componentView{Name: name}
+			byName[name] = component
+			components = append(components, component)
+		}
+		component.checks = append(component.checks, chk)
+	}
+
+	incidents := make([]incidentView, 0)
+	for _, component := range components {
+		component.State = componentState(component.checks)
+		reports := make([][]UptimeReport, 0)
+		for _, chk := range component.checks {
+			if p.Registry.History == nil {
+				break
+			}
+			checkEntries, err := p.Registry.History.Entries(chk.Name, since.Add(-uptimeLookback), time.Time{})
+			if err != nil {
+				log.Errorf("Error reading history of %s: %s", chk.Name, err)
+				continue
+			}
+			// Days are measured like uptime reports, by how long the check
+			// was up or down.
+			maxGap := uptimeMaxGapIntervals * chk.Interval
+			reports = append(reports, dailyUptime(chk.Name, checkEntries, since, p.Days, now, maxGap))
+			for _, incident := range Incidents(chk.Name, checkEntries) {
+				if !incident.Ongoing() && incident.End.Before(incidentsSince) {
+					continue
+				}
+				view := incidentView{
+					Component: component.Name,
+					Start:     incident.Start.UTC().Format("2006-01-02 15:04 MST"),
+					Ongoing:   incident.Ongoing(),
+					start:     incident.Start,
+				}
+				if !view.Ongoing {
+					view.Duration = incident.End.Sub(incident.Start).Round(time.Second).String()
+				}
+				incidents = append(incidents, view)
+			}
+		}
+		component.Days, component.Uptime = dayBars(reports, since, p.Days)
+	}
+	sort.SliceStable(incidents, func(i, j int) bool {
+		return incidents[i].start.After(incidents[j].start)
+	})
+	if len(incidents) > statusPageMaxIncidents {
+		incidents = incidents[:statusPageMaxIncidents]
+	}
+
+	return &statusPageData{
+		Title:        p.Title,
+		Refresh:      statusPageRefresh,
+		Days:         p.Days,
+		IncidentDays: statusPageIncidentDays,
+		State:        overallState(components),
+		Components:   components,
+		Incidents:    incidents,
+		Generated:    now.Format("2006-01-02 15:04:05 MST"),
+	}
+}
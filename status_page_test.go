@@ -0,0 +1,118 @@
+package healthchecker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	ht "net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusPageRender(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	registry := NewRegistry()
+	registry.History = NewMemoryHistory(0)
+	registry.CheckConstructors["testing"] = testingCheckConstructor
+	api, _ := registry.AddCheck("api-http", "testing", nil, 60, nil)
+	api.Component = "API"
+	apiTCP, _ := registry.AddCheck("api-tcp", "testing", nil, 60, nil)
+	apiTCP.Component = "API"
+	website, _ := registry.AddCheck("website", "testing", nil, 60, nil)
+	website.Component = "Website"
+	registry.AddCheck("internal", "testing", nil, 60, nil)
+
+	record := func(chk *HealthCheck, at time.Time, code ResultCode) {
+		state := chk.state.update(&Result{Timestamp: at, Result: code})
+		registry.History.Record(chk.Name, NewHistoryEntry(&Result{Timestamp: at, Result: code, Message: "secret"}, &state))
+	}
+	yesterday := now.Add(-24 * time.Hour)
+	for i := 0; i < 10; i++ {
+		code := Success
+		if i == 3 {
+			code = Failure
+		}
+		record(api, yesterday.Add(time.Duration(i)*time.Minute), code)
+		record(apiTCP, yesterday.Add(time.Duration(i)*time.Minute), Success)
+	}
+	record(api, now.Add(-time.Minute), Success)
+	record(apiTCP, now.Add(-time.Minute), Failure)
+
+	page := NewStatusPage(registry).render(now)
+	if len(page.Components) != 2 || page.Components[0].Name != "API" || page.Components[1].Name != "Website" {
+		t.Fatalf("Unexpected components: %+v", page.Components)
+	}
+	apiView := page.Components[0]
+	if apiView.State != stateDegraded || page.State != stateDegraded {
+		t.Errorf("Expected API and overall state to be degraded, got %s and %s", apiView.State.Label, page.State.Label)
+	}
+	if page.Components[1].State != stateUnknown {
+		t.Errorf("Expected website without results to be unknown, got %s", page.Components[1].State.Label)
+	}
+	if len(apiView.Days) != defaultStatusPageDays {
+		t.Fatalf("Expected %d day bars, got %d", defaultStatusPageDays, len(apiView.Days))
+	}
+	// api-http was down for 1 of the 12 minutes its results cover, up to 3
+	// intervals after the last one, and api-tcp was up for all of them.
+	if bar := apiView.Days[len(apiView.Days)-2]; bar.Class != "minor" || !strings.Contains(bar.Label, "95.83%") {
+		t.Errorf("Unexpected bar for yesterday: %+v", bar)
+	}
+	if bar := apiView.Days[len(apiView.Days)-1]; bar.Class != "major" {
+		t.Errorf("Unexpected bar for today: %+v", bar)
+	}
+	if bar := apiView.Days[0]; bar.Class != "nodata" {
+		t.Errorf("Unexpected bar without data: %+v", bar)
+	}
+	if len(page.Incidents) != 2 || !page.Incidents[0].Ongoing || page.Incidents[1].Duration != "1m0s" {
+		t.Errorf("Unexpected incidents: %+v", page.Incidents)
+	}
+
+	cached := NewStatusPage(registry)
+	first := cached.data(now)
+	if cached.data(now.Add(statusPageCacheTTL/2)) != first {
+		t.Errorf("Expected the page to be rendered once within the cache TTL")
+	}
+	if cached.data(now.Add(statusPageCacheTTL)) == first {
+		t.Errorf("Expected the page to be rendered again after the cache TTL")
+	}
+}
+
+func TestStatusPageServe(t *testing.T) {
+	registry := NewRegistry()
+	registry.History = NewMemoryHistory(0)
+	registry.CheckConstructors["failing"] = func(_ map[string]string) (CheckFunc, error) {
+		return func(_ context.Context) *Result {
+			return &Result{Timestamp: time.Now(), Result: Failure, Message: "secret"}
+		}, nil
+	}
+	chk, _ := registry.AddCheck("internal-db", "failing", nil, 60, nil)
+	chk.Component = "Database <primary>"
+	chk.Run(context.Background())
+
+	handler := NewStatusHandler(registry)
+	handler.Page.Title = "Example status"
+	rec := ht.NewRecorder()
+	handler.ServeHTTP(rec, ht.NewRequest(http.MethodGet, "/", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	page := string(body)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, expected := range []string{"Example status", "Database &lt;primary&gt;", "Major outage", "(ongoing)"} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Expected page to contain %q", expected)
+		}
+	}
+	for _, hidden := range []string{"internal-db", "secret", "http://", "https://"} {
+		if strings.Contains(page, hidden) {
+			t.Errorf("Page should not contain %q", hidden)
+		}
+	}
+
+	rec = ht.NewRecorder()
+	handler.ServeHTTP(rec, ht.NewRequest(http.MethodGet, "/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown path, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package healthchecker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTLSPort     = "443"
+	defaultTLSWarnDays = 30
+	defaultTLSCritDays = 7
+	hoursInDay         = 24
+)
+
+type TLSChecker struct {
+	Dialer  *net.Dialer
+	RootCAs *x509.CertPool
+	Timeout time.Duration
+}
+
+func NewTLSChecker(timeout time.Duration) *TLSChecker {
+	checker := TLSChecker{
+		Dialer:  &net.Dialer{},
+		Timeout: timeout,
+	}
+	return &checker
+}
+
+// fetchChain performs the handshake without verification, so that expiry
+// can still be reported for certificates that fail chain validation.
+func (t *TLSChecker) fetchChain(ctx context.Context, addr, serverName string) ([]*x509.Certificate, error) {
+	rawConn, err := t.Dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	defer conn.Close()
+	conn.SetDeadline(contextDeadline(ctx))
+	defer cancelOnDone(ctx, conn)()
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates, nil
+}
+
+func (t *TLSChecker) verifyChain(certs []*x509.Certificate, serverName string) ([]*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		Roots:         t.RootCAs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	chain := chains[0]
+	// The root is trusted locally, only the leaf and intermediates served
+	// by the host are subject to the expiry thresholds.
+	if len(chain) > 1 {
+		chain = chain[:len(chain)-1]
+	}
+	return chain, nil
+}
+
+func daysUntil(t time.Time, now time.Time) float64 {
+	return math.Floor(t.Sub(now).Hours()/hoursInDay*100) / 100
+}
+
+func (t *TLSChecker) TLSCertCheck(ctx context.Context, addr, serverName string, warnDays, critDays int) *Result {
+	ctx, cancel := withDefaultTimeout(ctx, t.Timeout)
+	defer cancel()
+	timeStart := time.Now()
+	certs, err := t.fetchChain(ctx, addr, serverName)
+	res := &Result{
+		Timestamp: timeStart,
+		Result:    Success,
+		Duration:  time.Since(timeStart),
+	}
+	if err != nil {
+		log.Debugf("TLSCertCheck to %s failed: %v", addr, err)
+		code, category := classifyNetError(err)
+		res.Fail(code, category, "%s", err)
+		return res
+	}
+	if len(certs) == 0 {
+		log.Debugf("TLSCertCheck to %s failed: no peer certificates", addr)
+		res.Fail(Failure, CategoryTLS, "%s presented no certificates", addr)
+		return res
+	}
+
+	chain, err := t.verifyChain(certs, serverName)
+	if err != nil {
+		log.Debugf("TLSCertCheck to %s couldn't verify chain: %v", addr, err)
+		res.Fail(Failure, CategoryTLS, "%s", err)
+		chain = certs
+	}
+
+	daysRemaining := math.Inf(1)
+	var expiring *x509.Certificate
+	for _, cert := range chain {
+		if days := daysUntil(cert.NotAfter, timeStart); days < daysRemaining {
+			daysRemaining = days
+			expiring = cert
+		}
+	}
+	expiryWarning := 0.0
+	if daysRemaining < float64(warnDays) {
+		log.Warnf("TLSCertCheck to %s: certificate expires in %.2f days", addr, daysRemaining)
+		expiryWarning = 1
+	}
+	if daysRemaining < float64(critDays) && res.Result == Success {
+		res.Fail(Failure, CategoryExpiry, "certificate '%s' expires in %.2f days", expiring.Subject.CommonName, daysRemaining)
+	}
+	res.SetMetric("days_remaining", daysRemaining)
+	res.SetMetric("expiry_warning", expiryWarning)
+	return res
+}
+
+var TLSCertCheckArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "host", Required: true, Description: "host to connect to"},
+	{Name: "port", Type: ArgPort, Default: defaultTLSPort, Description: "port to connect to"},
+	{Name: "serverName", Description: "name to verify the certificate against, defaults to host"},
+	{Name: "warnDays", Type: ArgInt, Default: strconv.Itoa(defaultTLSWarnDays), Description: "log a warning when a certificate expires within this many days"},
+	{Name: "critDays", Type: ArgInt, Default: strconv.Itoa(defaultTLSCritDays), Description: "fail when a certificate expires within this many days"},
+}}
+
+func (t *TLSChecker) NewTLSCertCheck(args map[string]string) (CheckFunc, error) {
+	host, ok := args["host"]
+	if !ok {
+		return nil, fmt.Errorf("TLSCertCheck missing 'host' parameter")
+	}
+	port, err := TLSCertCheckArgs.Int(args, "port")
+	if err != nil {
+		return nil, fmt.Errorf("TLSCertCheck %s", err)
+	}
+	serverName, ok := args["serverName"]
+	if !ok {
+		serverName = host
+	}
+	warnDays, err := TLSCertCheckArgs.Int(args, "warnDays")
+	if err != nil {
+		return nil, fmt.Errorf("TLSCertCheck %s", err)
+	}
+	critDays, err := TLSCertCheckArgs.Int(args, "critDays")
+	if err != nil {
+		return nil, fmt.Errorf("TLSCertCheck %s", err)
+	}
+	if critDays > warnDays {
+		return nil, fmt.Errorf("TLSCertCheck 'critDays' (%d) cannot be larger than 'warnDays' (%d)", critDays, warnDays)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	return func(ctx context.Context) *Result {
+		return t.TLSCertCheck(ctx, addr, serverName, warnDays, critDays)
+	}, nil
+}
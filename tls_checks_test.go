@@ -0,0 +1,182 @@
+package healthchecker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, notAfter time.Time, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Couldn't generate key: %s", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !isCA {
+		template.DNSNames = []string{name}
+	}
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Couldn't create certificate: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+func startTLSServer(t *testing.T, chain ...*testCert) net.Listener {
+	tlsCert := tls.Certificate{PrivateKey: chain[0].key}
+	for _, c := range chain {
+		tlsCert.Certificate = append(tlsCert.Certificate, c.cert.Raw)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{tlsCert}})
+	if err != nil {
+		t.Fatalf("Couldn't start tls listener: %s", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestTLSCertCheck(t *testing.T) {
+	now := time.Now()
+	days := func(n int) time.Time { return now.Add(time.Duration(n) * hoursInDay * time.Hour) }
+	root := newTestCert(t, "Test Root", days(3650), nil, true)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	tlsTests := []struct {
+		name       string
+		chain      func() []*testCert
+		serverName string
+		result     ResultCode
+		minDays    float64
+		maxDays    float64
+	}{
+		{"valid", func() []*testCert {
+			inter := newTestCert(t, "Test Intermediate", days(365), root, true)
+			return []*testCert{newTestCert(t, "example.test", days(90), inter, false), inter}
+		}, "example.test", Success, 89, 90},
+		{"leaf expiring", func() []*testCert {
+			inter := newTestCert(t, "Test Intermediate", days(365), root, true)
+			return []*testCert{newTestCert(t, "example.test", days(3), inter, false), inter}
+		}, "example.test", Failure, 2, 3},
+		{"intermediate expiring", func() []*testCert {
+			inter := newTestCert(t, "Test Intermediate", days(5), root, true)
+			return []*testCert{newTestCert(t, "example.test", days(90), inter, false), inter}
+		}, "example.test", Failure, 4, 5},
+		{"hostname mismatch", func() []*testCert {
+			return []*testCert{newTestCert(t, "example.test", days(90), root, false)}
+		}, "other.test", Failure, 89, 90},
+		{"untrusted chain", func() []*testCert {
+			return []*testCert{newTestCert(t, "example.test", days(90), nil, false)}
+		}, "example.test", Failure, 89, 90},
+		{"expired", func() []*testCert {
+			return []*testCert{newTestCert(t, "example.test", days(-2), root, false)}
+		}, "example.test", Failure, -3, -1},
+	}
+
+	for _, tt := range tlsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln := startTLSServer(t, tt.chain()...)
+			defer ln.Close()
+			host, port, _ := net.SplitHostPort(ln.Addr().String())
+
+			checker := NewTLSChecker(time.Second)
+			checker.RootCAs = roots
+			checkFunc, err := checker.NewTLSCertCheck(map[string]string{
+				"host":       host,
+				"port":       port,
+				"serverName": tt.serverName,
+				"warnDays":   "30",
+				"critDays":   "7",
+			})
+			if err != nil {
+				t.Fatalf("Couldn't create check: %s", err)
+			}
+			res := checkFunc(context.Background())
+			if res.Result != tt.result {
+				t.Errorf("Got: %s, Wanted: %s", res.Result, tt.result)
+			}
+			if days := res.Metrics["days_remaining"]; days < tt.minDays || days > tt.maxDays {
+				t.Errorf("Expected days_remaining between %v and %v, got: %v", tt.minDays, tt.maxDays, days)
+			}
+		})
+	}
+}
+
+func TestTLSCertCheckConnectionError(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	checker := NewTLSChecker(time.Second)
+	checkFunc, _ := checker.NewTLSCertCheck(map[string]string{"host": host, "port": port})
+	res := checkFunc(context.Background())
+	if res.Result != Error {
+		t.Errorf("Expected Error on refused connection, got: %s", res.Result)
+	}
+}
+
+func TestNewTLSCertCheckArgs(t *testing.T) {
+	argTests := []struct {
+		name    string
+		args    map[string]string
+		succeed bool
+	}{
+		{"no host", map[string]string{"port": "443"}, false},
+		{"bad port", map[string]string{"host": "example.com", "port": "https"}, false},
+		{"bad warnDays", map[string]string{"host": "example.com", "warnDays": "soon"}, false},
+		{"crit above warn", map[string]string{"host": "example.com", "warnDays": "7", "critDays": "30"}, false},
+		{"defaults", map[string]string{"host": "example.com"}, true},
+	}
+
+	checker := NewTLSChecker(time.Second)
+	for _, tt := range argTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checker.NewTLSCertCheck(tt.args)
+			if !tt.succeed && err == nil {
+				t.Errorf("Got %#v, expected to fail but succeeded", tt.args)
+			}
+			if tt.succeed && err != nil {
+				t.Errorf("Got %#v, expected to succeed but failed: %s", tt.args, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package healthchecker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// How far before the start of a window history is read to find the
+	// state a check was in when the window started.
+	uptimeLookback = hoursInDay * time.Hour
+	// Gaps between results longer than this many intervals, eg. while
+	// healthchecker wasn't running, are not counted as up or down.
+	uptimeMaxGapIntervals = 3
+	defaultReportDays     = 30
+)
+
+// UptimeReport is the availability of a check over a window. Time is counted
+// as down while the check's status was down, time not covered by any result
+// is left out.
+type UptimeReport struct {
+	Check        string
+	From         time.Time
+	To           time.Time
+	Availability float64
+	Observed     time.Duration
+	Downtime     time.Duration
+	Incidents    int
+	MTTR         time.Duration
+	MTBF         time.Duration
+}
+
+// CalculateUptime computes the uptime of a check over [from, to) from its
+// entries, oldest first. Each entry counts until the next one, but for no
+// longer than maxGap if it's positive. Time in maintenance or while upstream
+// was down isn't observed.
+func CalculateUptime(name string, entries []HistoryEntry, from, to time.Time, maxGap time.Duration) UptimeReport {
+	report := UptimeReport{Check: name, From: from, To: to}
+	var uptime time.Duration
+	wasDown := false
+	for i, entry := range entries {
+		start, end := entry.Timestamp, to
+		if i+1 < len(entries) {
+			end = entries[i+1].Timestamp
+		}
+		if maxGap > 0 && end.Sub(start) > maxGap {
+			end = start.Add(maxGap)
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) || !entry.observed() {
+			continue
+		}
+
+		down := entry.Status == StatusDown
+		// An incident starts when the check goes down, or is already down
+		// when the window starts. Being down on both sides of a maintenance
+		// is the same incident.
+		if down && !wasDown {
+			report.Incidents++
+		}
+		wasDown = down
+		if down {
+			report.Downtime += end.Sub(start)
+		} else {
+			uptime += end.Sub(start)
+		}
+	}
+	report.Observed = uptime + report.Downtime
+	if report.Observed > 0 {
+		report.Availability = float64(uptime) / float64(report.Observed) * 100
+	}
+	if report.Incidents > 0 {
+		report.MTTR = report.Downtime / time.Duration(report.Incidents)
+		report.MTBF = uptime / time.Duration(report.Incidents)
+	}
+	return report
+}
+
+// dailyUptime computes the uptime of a check for each of days days starting
+// at from, like CalculateUptime does for a single window. Days are cut short
+// at now.
+func dailyUptime(name string, entries []HistoryEntry, from time.Time, days int, now time.Time, maxGap time.Duration) []UptimeReport {
+	reports := make([]UptimeReport, days)
+	for day := range reports {
+		start, end := from.AddDate(0, 0, day), from.AddDate(0, 0, day+1)
+		if end.After(now) {
+			end = now
+		}
+		// Only the entries of the day matter, along with the one before it,
+		// which is the state the day started in, and the one after it, which
+		// ends the day's last entry.
+		first := sort.Search(len(entries), func(i int) bool { return !entries[i].Timestamp.Before(start) })
+		last := sort.Search(len(entries), func(i int) bool { return !entries[i].Timestamp.Before(end) })
+		if first > 0 {
+			first--
+		}
+		if last < len(entries) {
+			last++
+		}
+		reports[day] = CalculateUptime(name, entries[first:last], start, end, maxGap)
+	}
+	return reports
+}
+
+// UptimeFromHistory computes the uptime of the named check, run every
+// interval, from history over [from, to). to is capped at the current time.
+func UptimeFromHistory(history History, name string, interval time.Duration, from, to time.Time) (UptimeReport, error) {
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+	entries, err := history.Entries(name, from.Add(-uptimeLookback), to)
+	if err != nil {
+		return UptimeReport{}, err
+	}
+	return CalculateUptime(name, entries, from, to, uptimeMaxGapIntervals*interval), nil
+}
+
+// UptimeReport computes the uptime of the named check from the registry's
+// history, see UptimeFromHistory.
+func (c *Registry) UptimeReport(name string, from, to time.Time) (UptimeReport, error) {
+	if c.History == nil {
+		return UptimeReport{}, fmt.Errorf("no history is being recorded")
+	}
+	var interval time.Duration
+	for _, chk := range c.CurrentChecks() {
+		if chk.Name == name {
+			interval = chk.Interval
+		}
+	}
+	return UptimeFromHistory(c.History, name, interval, from, to)
+}
+
+// UptimeReports computes the uptime of every current check over [from, to).
+func (c *Registry) UptimeReports(from, to time.Time) ([]UptimeReport, error) {
+	reports := make([]UptimeReport, 0)
+	for _, chk := range c.CurrentChecks() {
+		report, err := c.UptimeReport(chk.Name, from, to)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+type uptimeReportJSON struct {
+	Check           string    `json:"check"`
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	Availability    *float64  `json:"availabilityPercent"`
+	ObservedSeconds float64   `json:"observedSeconds"`
+	DowntimeSeconds float64   `json:"downtimeSeconds"`
+	Incidents       int       `json:"incidents"`
+	MTTRSeconds     float64   `json:"mttrSeconds"`
+	MTBFSeconds     float64   `json:"mtbfSeconds"`
+}
+
+// MarshalJSON reports durations in seconds and availability as null when
+// nothing was observed.
+func (r UptimeReport) MarshalJSON() ([]byte, error) {
+	out := uptimeReportJSON{
+		Check:           r.Check,
+		From:            r.From,
+		To:              r.To,
+		ObservedSeconds: r.Observed.Seconds(),
+		DowntimeSeconds: r.Downtime.Seconds(),
+		Incidents:       r.Incidents,
+		MTTRSeconds:     r.MTTR.Seconds(),
+		MTBFSeconds:     r.MTBF.Seconds(),
+	}
+	if r.Observed > 0 {
+		out.Availability = &r.Availability
+	}
+	return json.Marshal(out)
+}
+
+func (r UptimeReport) availabilityString() string {
+	if r.Observed == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.3f%%", r.Availability)
+}
+
+// WriteUptimeReports writes reports as "markdown", "csv" or "json".
+func WriteUptimeReports(w io.Writer, format string, reports []UptimeReport) error {
+	switch format {
+	case "markdown":
+		fmt.Fprintln(w, "| Check | Availability | Downtime | Incidents | MTTR | MTBF |")
+		fmt.Fprintln(w, "|---|---:|---:|---:|---:|---:|")
+		for _, r := range reports {
+			_, err := fmt.Fprintf(w, "| %s | %s | %s | %d | %s | %s |\n", r.Check, r.availabilityString(),
+				r.Downtime.Round(time.Second), r.Incidents, r.MTTR.Round(time.Second), r.MTBF.Round(time.Second))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"check", "from", "to", "availability_percent", "observed_seconds",
+			"downtime_seconds", "incidents", "mttr_seconds", "mtbf_seconds"})
+		for _, r := range reports {
+			availability := ""
+			if r.Observed > 0 {
+				availability = strconv.FormatFloat(r.Availability, 'f', 3, 64)
+			}
+			writer.Write([]string{r.Check, r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), availability,
+				seconds(r.Observed), seconds(r.Downtime), strconv.Itoa(r.Incidents), seconds(r.MTTR), seconds(r.MTBF)})
+		}
+		writer.Flush()
+		return writer.Error()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	default:
+		return fmt.Errorf("unknown report format '%s', use markdown, csv or json", format)
+	}
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 0, 64)
+}
+
+// ParseReportTime parses the start or end of a report window. It accepts
+// RFC3339 times, dates like 2006-01-02 (UTC midnight) and times relative to
+// now like 30d or 12h. An empty value is def.
+func ParseReportTime(value string, now, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	} else if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', use RFC3339, YYYY-MM-DD or an age like 30d", value)
+}
+
+// ReportWindow parses from and to with ParseReportTime, defaulting to the
+// last defaultReportDays days.
+func ReportWindow(from, to string, now time.Time) (time.Time, time.Time, error) {
+	start, err := ParseReportTime(from, now, now.AddDate(0, 0, -defaultReportDays))
+	if err != nil {
+		return start, start, err
+	}
+	end, err := ParseReportTime(to, now, now)
+	if err != nil {
+		return start, end, err
+	}
+	if !start.Before(end) {
+		return start, end, fmt.Errorf("report window start %s is not before its end %s",
+			start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
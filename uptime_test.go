@@ -0,0 +1,155 @@
+package healthchecker
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalculateUptime(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+	entries := []HistoryEntry{
+		// Already down before the window starts.
+		{Timestamp: at(-5), Status: StatusDown},
+		{Timestamp: at(10), Status: StatusUp},
+		{Timestamp: at(40), Status: StatusDown},
+		{Timestamp: at(50), Status: StatusDown},
+		{Timestamp: at(60), Status: StatusUp},
+		// A gap while nothing was running.
+		{Timestamp: at(200), Status: StatusUp},
+	}
+
+	report := CalculateUptime("web", entries, at(0), at(210), 30*time.Minute)
+	if report.Incidents != 2 {
+		t.Errorf("Expected 2 incidents, got %d", report.Incidents)
+	}
+	if report.Downtime != 30*time.Minute {
+		t.Errorf("Expected 30m of downtime, got %s", report.Downtime)
+	}
+	if report.Observed != 100*time.Minute {
+		t.Errorf("Expected gaps to be left out, got %s observed", report.Observed)
+	}
+	if report.Availability != 70 {
+		t.Errorf("Expected 70%% availability, got %f", report.Availability)
+	}
+	if report.MTTR != 15*time.Minute || report.MTBF != 35*time.Minute {
+		t.Errorf("Unexpected MTTR %s and MTBF %s", report.MTTR, report.MTBF)
+	}
+
+	maintenance := []HistoryEntry{
+		{Timestamp: at(0), Status: StatusUp},
+		{Timestamp: at(10), Status: StatusDown},
+		{Timestamp: at(20), Status: StatusDown, Maintenance: true},
+		{Timestamp: at(40), Status: StatusDown},
+		{Timestamp: at(50), Status: StatusUp},
+	}
+	report = CalculateUptime("web", maintenance, at(0), at(60), 0)
+	if report.Observed != 40*time.Minute || report.Downtime != 20*time.Minute {
+		t.Errorf("Expected maintenance to be left out, got %s observed and %s down", report.Observed, report.Downtime)
+	}
+	if report.Incidents != 1 {
+		t.Errorf("Expected being down around maintenance to be 1 incident, got %d", report.Incidents)
+	}
+
+	empty := CalculateUptime("web", nil, at(0), at(10), 0)
+	if empty.Observed != 0 || empty.Incidents != 0 || empty.availabilityString() != "n/a" {
+		t.Errorf("Unexpected report without entries: %+v", empty)
+	}
+}
+
+func TestDailyUptime(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time { return start.Add(time.Duration(hour) * time.Hour) }
+	entries := []HistoryEntry{
+		{Timestamp: at(-2), Status: StatusUp},
+		{Timestamp: at(20), Status: StatusDown},
+		{Timestamp: at(30), Status: StatusUp},
+		{Timestamp: at(60), Status: StatusUp},
+	}
+
+	reports := dailyUptime("web", entries, start, 3, at(66), 0)
+	for day, report := range reports {
+		expected := CalculateUptime("web", entries, at(24*day), at(24*day+24), 0)
+		if day == 2 {
+			// Today ends now.
+			expected = CalculateUptime("web", entries, at(48), at(66), 0)
+		}
+		if report != expected {
+			t.Errorf("Day %d: expected %+v, got %+v", day, expected, report)
+		}
+	}
+	if reports[0].Downtime != 4*time.Hour || reports[1].Downtime != 6*time.Hour || reports[2].Observed != 18*time.Hour {
+		t.Errorf("Unexpected daily uptime: %+v", reports)
+	}
+}
+
+func TestWriteUptimeReports(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	reports := []UptimeReport{
+		{Check: "web", From: from, To: from.Add(time.Hour), Availability: 99.5, Observed: time.Hour,
+			Downtime: 18 * time.Second, Incidents: 1, MTTR: 18 * time.Second, MTBF: 3582 * time.Second},
+		{Check: "db", From: from, To: from.Add(time.Hour)},
+	}
+
+	var out bytes.Buffer
+	if err := WriteUptimeReports(&out, "markdown", reports); err != nil {
+		t.Fatalf("Couldn't write markdown: %s", err)
+	}
+	if !strings.Contains(out.String(), "| web | 99.500% | 18s | 1 | 18s | 59m42s |") ||
+		!strings.Contains(out.String(), "| db | n/a |") {
+		t.Errorf("Unexpected markdown:\n%s", out.String())
+	}
+
+	out.Reset()
+	WriteUptimeReports(&out, "csv", reports)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[1] != "web,2026-01-01T00:00:00Z,2026-01-01T01:00:00Z,99.500,3600,18,1,18,3582" {
+		t.Errorf("Unexpected CSV:\n%s", out.String())
+	}
+
+	out.Reset()
+	WriteUptimeReports(&out, "json", reports)
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Couldn't decode JSON report: %s", err)
+	}
+	if decoded[0]["availabilityPercent"] != 99.5 || decoded[1]["availabilityPercent"] != nil {
+		t.Errorf("Unexpected JSON: %s", out.String())
+	}
+
+	if err := WriteUptimeReports(&out, "xml", reports); err == nil {
+		t.Error("Expected an unknown format to fail")
+	}
+}
+
+func TestReportWindow(t *testing.T) {
+	now := time.Date(2026, 2, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		from, to string
+		start    time.Time
+		end      time.Time
+		succeed  bool
+	}{
+		{"default", "", "", now.AddDate(0, 0, -30), now, true},
+		{"dates", "2026-01-01", "2026-02-01", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), true},
+		{"ages", "7d", "12h", now.AddDate(0, 0, -7), now.Add(-12 * time.Hour), true},
+		{"rfc3339", "2026-02-15T10:00:00Z", "", time.Date(2026, 2, 15, 10, 0, 0, 0, time.UTC), now, true},
+		{"invalid", "last month", "", time.Time{}, time.Time{}, false},
+		{"backwards", "1d", "2d", time.Time{}, time.Time{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, err := ReportWindow(test.from, test.to, now)
+			if (err == nil) != test.succeed {
+				t.Fatalf("Expected success %t, got error: %v", test.succeed, err)
+			}
+			if test.succeed && (!start.Equal(test.start) || !end.Equal(test.end)) {
+				t.Errorf("Expected %s - %s, got %s - %s", test.start, test.end, start, end)
+			}
+		})
+	}
+}
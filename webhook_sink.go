@@ -0,0 +1,256 @@
+package healthchecker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWebhookTemplate    = `{"text": {{ printf "%s (%s) is %s: %s" .Name .Type .Result .Message | json }}}`
+	defaultWebhookContentType = "application/json"
+	defaultWebhookTimeout     = 10
+	defaultWebhookRetries     = 3
+	defaultWebhookRetryDelay  = 1000
+	webhookQueueSize          = 100
+	webhookHeaderPrefix       = "header."
+
+	// Close gives up on delivering queued results after this long.
+	defaultWebhookCloseTimeout = 5 * time.Second
+)
+
+// WebhookPayload is the data available to the webhook body template.
+type WebhookPayload struct {
+	Name      string
+	Type      string
+	Result    string
+	Timestamp time.Time
+	Duration  time.Duration
+	Message   string
+	Category  string
+	Metrics   map[string]float64
+	Attempts  int
+	State     string
+	Changed   bool
+}
+
+type WebhookSink struct {
+	Client     *http.Client
+	URL        string
+	Headers    map[string]string
+	Template   *template.Template
+	Retries    int
+	RetryDelay time.Duration
+	// CloseTimeout is how long Close keeps delivering queued results.
+	CloseTimeout time.Duration
+	queue        chan *WebhookPayload
+	mu           sync.Mutex
+	closed       bool
+	done         chan struct{}
+	// abort is cancelled when Close gives up on the queued results.
+	abort       context.Context
+	cancelAbort context.CancelFunc
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+var WebhookSinkArgs = ArgSchema{Args: []ArgSpec{
+	{Name: "url", Type: ArgURL, Required: true, Description: "URL to POST results to"},
+	{Name: "template", Default: defaultWebhookTemplate, Description: "text/template of the request body"},
+	{Name: "timeout", Type: ArgInt, Default: strconv.Itoa(defaultWebhookTimeout), Description: "request timeout in seconds"},
+	{Name: "retries", Type: ArgInt, Default: strconv.Itoa(defaultWebhookRetries), Description: "retries on network errors, 5xx and 429 responses"},
+	{Name: "retryDelay", Type: ArgInt, Default: strconv.Itoa(defaultWebhookRetryDelay), Description: "milliseconds before the first retry, doubled after each one"},
+	{Name: webhookHeaderPrefix + "*", Description: "request header, eg. header.Authorization"},
+}}
+
+func NewWebhookSink(args map[string]string) (Emitter, error) {
+	errPrefix := "Error creating WebhookSink -"
+	url, ok := args["url"]
+	if !ok {
+		return nil, fmt.Errorf("%s url parameter missing", errPrefix)
+	}
+	templateText, _ := WebhookSinkArgs.Lookup(args, "template")
+	tmpl, err := template.New("webhook").Funcs(webhookTemplateFuncs).Parse(templateText)
+	if err != nil {
+		return nil, fmt.Errorf("%s invalid template: %s", errPrefix, err)
+	}
+	timeout, err := WebhookSinkArgs.Int(args, "timeout")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+	retries, err := WebhookSinkArgs.Int(args, "retries")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+	retryDelay, err := WebhookSinkArgs.Int(args, "retryDelay")
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	headers := map[string]string{"Content-Type": defaultWebhookContentType}
+	for arg, value := range args {
+		if strings.HasPrefix(arg, webhookHeaderPrefix) {
+			headers[strings.TrimPrefix(arg, webhookHeaderPrefix)] = value
+		}
+	}
+
+	abort, cancelAbort := context.WithCancel(context.Background())
+	sink := &WebhookSink{
+		Client:       &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		URL:          url,
+		Headers:      headers,
+		Template:     tmpl,
+		Retries:      retries,
+		RetryDelay:   time.Duration(retryDelay) * time.Millisecond,
+		CloseTimeout: defaultWebhookCloseTimeout,
+		queue:        make(chan *WebhookPayload, webhookQueueSize),
+		done:         make(chan struct{}),
+		abort:        abort,
+		cancelAbort:  cancelAbort,
+	}
+	go sink.deliveryRoutine()
+	return sink, nil
+}
+
+func (w *WebhookSink) deliveryRoutine() {
+	defer close(w.done)
+	dropped := 0
+	for payload := range w.queue {
+		if w.abort.Err() != nil {
+			dropped++
+			continue
+		}
+		w.deliver(payload)
+	}
+	if dropped > 0 {
+		log.Errorf("WebhookSink closed with %d undelivered results, dropping them", dropped)
+	}
+}
+
+func (w *WebhookSink) render(payload *WebhookPayload) ([]byte, error) {
+	var body bytes.Buffer
+	if err := w.Template.Execute(&body, payload); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// post sends body once and reports whether a failed attempt is worth retrying.
+func (w *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(w.abort)
+	for header, value := range w.Headers {
+		req.Header.Set(header, value)
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook responded with %s", resp.Status)
+}
+
+func (w *WebhookSink) deliver(payload *WebhookPayload) {
+	body, err := w.render(payload)
+	if err != nil {
+		log.Errorf("WebhookSink couldn't render template for %s: %s", payload.Name, err)
+		return
+	}
+	delay := w.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= w.Retries || w.abort.Err() != nil {
+			log.Errorf("WebhookSink giving up on %s result after %d attempts: %s", payload.Name, attempt+1, err)
+			return
+		}
+		log.Debugf("WebhookSink attempt %d for %s failed, retrying in %s: %s", attempt+1, payload.Name, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-w.abort.Done():
+		}
+		delay *= 2
+	}
+}
+
+func (w *WebhookSink) Emit(name, checkType string, c *Result, s *CheckState) {
+	if !c.notify() {
+		log.Debugf("WebhookSink suppressing %s result (%s)", name, c.Result)
+		return
+	}
+	payload := &WebhookPayload{
+		Name:      name,
+		Type:      checkType,
+		Result:    c.Result.String(),
+		Timestamp: c.Timestamp,
+		Duration:  c.Duration,
+		Message:   c.Message,
+		Category:  string(c.Category),
+		Metrics:   c.Metrics,
+		Attempts:  c.Attempts,
+	}
+	if s != nil {
+		payload.State = s.Status.String()
+		payload.Changed = s.Changed
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		log.Errorf("WebhookSink is closed, dropping %s result", name)
+		return
+	}
+	select {
+	case w.queue <- payload:
+	default:
+		log.Errorf("WebhookSink queue is full, dropping %s result", name)
+	}
+}
+
+func (w *WebhookSink) Name() string {
+	return "WebhookSink"
+}
+
+// Close waits up to CloseTimeout for queued payloads to be delivered, and
+// drops the ones left after that.
+func (w *WebhookSink) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+	defer w.cancelAbort()
+	select {
+	case <-w.done:
+	case <-time.After(w.CloseTimeout):
+		w.cancelAbort()
+		<-w.done
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package healthchecker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	ht "net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookRecorder struct {
+	mu       sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	statuses []int
+}
+
+func (wr *webhookRecorder) handler(w http.ResponseWriter, r *http.Request) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	wr.bodies = append(wr.bodies, string(body))
+	wr.headers = append(wr.headers, r.Header)
+	status := http.StatusOK
+	if len(wr.statuses) > 0 {
+		status, wr.statuses = wr.statuses[0], wr.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (wr *webhookRecorder) requests() int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return len(wr.bodies)
+}
+
+func TestWebhookSinkTemplate(t *testing.T) {
+	recorder := &webhookRecorder{}
+	ts := ht.NewServer(http.HandlerFunc(recorder.handler))
+	defer ts.Close()
+
+	sink, err := NewWebhookSink(map[string]string{
+		"url":                  ts.URL,
+		"template":             `{"check": {{ json .Name }}, "result": "{{ .Result }}", "status": {{ index .Metrics "status_code" }}, "state": "{{ .State }}"}`,
+		"header.Authorization": "Bearer secret",
+	})
+	if err != nil {
+		t.Fatalf("Couldn't create WebhookSink: %s", err)
+	}
+	res := &Result{Timestamp: time.Now(), Result: Failure}
+	res.SetMetric("status_code", 503)
+	sink.Emit(`blog "main"`, "SimpleHTTPCheck", res, &CheckState{Status: StatusDown})
+	sink.(*WebhookSink).Close()
+
+	if recorder.requests() != 1 {
+		t.Fatalf("Expected 1 webhook request, got %d", recorder.requests())
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(recorder.bodies[0]), &payload); err != nil {
+		t.Fatalf("Webhook body is not valid json: %s - %s", err, recorder.bodies[0])
+	}
+	if payload["check"] != `blog "main"` || payload["result"] != "Failure" || payload["status"] != 503.0 || payload["state"] != "down" {
+		t.Errorf("Unexpected webhook payload: %v", payload)
+	}
+	if recorder.headers[0].Get("Authorization") != "Bearer secret" || recorder.headers[0].Get("Content-Type") != "application/json" {
+		t.Errorf("Custom headers not sent: %v", recorder.headers[0])
+	}
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	retryTests := []struct {
+		name     string
+		statuses []int
+		requests int
+	}{
+		{"succeeds after server errors", []int{500, 503, 200}, 3},
+		{"gives up after retries", []int{500, 500, 500, 500, 500}, 3},
+		{"does not retry client errors", []int{400, 200}, 1},
+	}
+
+	for _, tt := range retryTests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &webhookRecorder{statuses: tt.statuses}
+			ts := ht.NewServer(http.HandlerFunc(recorder.handler))
+			defer ts.Close()
+
+			sink, _ := NewWebhookSink(map[string]string{
+				"url":        ts.URL,
+				"retries":    "2",
+				"retryDelay": "1",
+			})
+			sink.Emit("check", "TestCheck", &Result{Timestamp: time.Now(), Result: Failure}, nil)
+			sink.(*WebhookSink).Close()
+
+			if recorder.requests() != tt.requests {
+				t.Errorf("Expected %d requests, got %d", tt.requests, recorder.requests())
+			}
+		})
+	}
+}
+
+func TestWebhookSinkCloseTimeout(t *testing.T) {
+	recorder := &webhookRecorder{statuses: []int{500, 500, 500, 500, 500, 500}}
+	ts := ht.NewServer(http.HandlerFunc(recorder.handler))
+	defer ts.Close()
+
+	sink, _ := NewWebhookSink(map[string]string{
+		"url":        ts.URL,
+		"retries":    "5",
+		"retryDelay": "1000",
+	})
+	sink.(*WebhookSink).CloseTimeout = 100 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		sink.Emit("check", "TestCheck", &Result{Timestamp: time.Now(), Result: Failure}, nil)
+	}
+	timeStart := time.Now()
+	sink.(*WebhookSink).Close()
+	if elapsed := time.Since(timeStart); elapsed > time.Second {
+		t.Errorf("Expected Close to give up after CloseTimeout, took %s", elapsed)
+	}
+	if recorder.requests() != 1 {
+		t.Errorf("Expected the queued results to be dropped after 1 request, got %d", recorder.requests())
+	}
+}
+
+func TestNewWebhookSink(t *testing.T) {
+	newSinkTests := []struct {
+		name    string
+		args    map[string]string
+		succeed bool
+	}{
+		{"no url", map[string]string{"template": "{}"}, false},
+		{"bad template", map[string]string{"url": "http://localhost", "template": "{{ .Name"}, false},
+		{"bad retries", map[string]string{"url": "http://localhost", "retries": "many"}, false},
+		{"defaults", map[string]string{"url": "http://localhost"}, true},
+	}
+
+	for _, tt := range newSinkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := NewWebhookSink(tt.args)
+			if !tt.succeed && err == nil {
+				t.Errorf("Got %#v, expected to fail but succeeded", tt.args)
+			}
+			if tt.succeed && err != nil {
+				t.Errorf("Got %#v, expected to succeed but failed: %s", tt.args, err)
+			}
+			if sink != nil {
+				sink.(*WebhookSink).Close()
+			}
+		})
+	}
+}